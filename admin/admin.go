@@ -0,0 +1,284 @@
+// Package admin implements the router's administrative endpoints.  The router's nginx healthz
+// server (on port 9090) proxies requests for these endpoints to a server listening only on the
+// loopback interface.
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deis/router/model"
+	"github.com/deis/router/nginx"
+)
+
+// Server serves the router's administrative endpoints using the router configuration most
+// recently applied to nginx.
+type Server struct {
+	mutex         sync.RWMutex
+	routerConfig  *model.RouterConfig
+	lastApplied   time.Time
+	lastBuild     time.Time
+	lastError     string
+	lastErrorTime time.Time
+	mux           *http.ServeMux
+}
+
+// buildStatus is the body of responses to GET /config.
+type buildStatus struct {
+	RouterConfig        *model.RouterConfig         `json:"routerConfig"`
+	LastApplied         *time.Time                  `json:"lastApplied"`
+	LastBuild           *time.Time                  `json:"lastBuild"`
+	LastError           *buildError                 `json:"lastError"`
+	RejectedAnnotations []*model.RejectedAnnotation `json:"rejectedAnnotations"`
+}
+
+type buildError struct {
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// route describes how requests for one domain are routed.  It is a summary of the router
+// configuration for the purpose of troubleshooting; the configuration itself has every detail.
+type route struct {
+	Domain      string           `json:"domain"`
+	App         string           `json:"app"`
+	Upstreams   []string         `json:"upstreams"`
+	Available   bool             `json:"available"`
+	TLS         bool             `json:"tls"`
+	Passthrough bool             `json:"passthrough"`
+	Whitelist   []string         `json:"whitelist"`
+	Maintenance bool             `json:"maintenance"`
+	Locations   []*routeLocation `json:"locations,omitempty"`
+}
+
+// routeLocation describes a path within a domain that is routed differently than the domain as a
+// whole, either because it has its own whitelist or because it has its own back end.  Whitelists
+// are nil when access isn't restricted.
+type routeLocation struct {
+	Path      string   `json:"path"`
+	Backend   string   `json:"backend,omitempty"`
+	Upstreams []string `json:"upstreams,omitempty"`
+	Available bool     `json:"available"`
+	Whitelist []string `json:"whitelist"`
+}
+
+// NewServer returns a pointer to a new Server.
+func NewServer() *Server {
+	s := &Server{
+		routerConfig: &model.RouterConfig{},
+		mux:          http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/cache/", s.handleCache)
+	s.mux.HandleFunc("/config", s.handleConfig)
+	s.mux.HandleFunc("/routes", s.handleRoutes)
+	return s
+}
+
+// SetRouterConfig records the router configuration most recently applied to nginx.
+func (s *Server) SetRouterConfig(routerConfig *model.RouterConfig) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.routerConfig = routerConfig
+	s.lastApplied = time.Now()
+}
+
+// SetBuildResult records the outcome of the most recent attempt to build router configuration
+// and apply it to nginx.  A nil error means the attempt succeeded, whether or not anything
+// changed; the last error is still reported afterwards, along with when it occurred.
+func (s *Server) SetBuildResult(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastBuild = time.Now()
+	if err != nil {
+		s.lastError = err.Error()
+		s.lastErrorTime = s.lastBuild
+	}
+}
+
+func (s *Server) getRouterConfig() *model.RouterConfig {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.routerConfig
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves the administrative endpoints on the given address.
+func (s *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s)
+}
+
+// handleCache purges an app's cached responses in response to DELETE /cache/<app name>.
+func (s *Server) handleCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed."})
+		return
+	}
+	appName := strings.Trim(strings.TrimPrefix(r.URL.Path, "/cache/"), "/")
+	routerConfig := s.getRouterConfig()
+	var appConfig *model.AppConfig
+	for _, candidate := range routerConfig.AppConfigs {
+		if candidate.Name == appName {
+			appConfig = candidate
+			break
+		}
+	}
+	if appConfig == nil || appConfig.Nginx == nil || appConfig.Nginx.CacheConfig == nil || !appConfig.Nginx.CacheConfig.Enabled {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "No cache found for app " + appName + "."})
+		return
+	}
+	purged, err := nginx.PurgeCache(routerConfig, appConfig)
+	if err != nil {
+		log.Printf("Failed to purge cache for app %s: %v", appName, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	log.Printf("INFO: Purged %d cached responses for app %s.", purged, appName)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"app": appName, "purged": purged})
+}
+
+// handleConfig responds to GET /config with the router configuration most recently applied to
+// nginx, with private keys redacted, and the outcome of recent builds.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed."})
+		return
+	}
+	s.mutex.RLock()
+	status := &buildStatus{
+		RouterConfig:        s.routerConfig,
+		LastApplied:         optionalTime(s.lastApplied),
+		LastBuild:           optionalTime(s.lastBuild),
+		RejectedAnnotations: s.routerConfig.RejectedAnnotations,
+	}
+	if s.lastError != "" {
+		status.LastError = &buildError{Message: s.lastError, Time: s.lastErrorTime}
+	}
+	s.mutex.RUnlock()
+	if status.RejectedAnnotations == nil {
+		status.RejectedAnnotations = []*model.RejectedAnnotation{}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleRoutes responds to GET /routes with a summary of how requests for each domain are routed,
+// sorted by domain.
+func (s *Server) handleRoutes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed."})
+		return
+	}
+	writeJSON(w, http.StatusOK, buildRoutes(s.getRouterConfig()))
+}
+
+func buildRoutes(routerConfig *model.RouterConfig) []*route {
+	routes := []*route{}
+	for _, appConfig := range routerConfig.AppConfigs {
+		for _, domain := range appConfig.Domains {
+			rt := &route{
+				Domain:      routeDomain(routerConfig, domain),
+				App:         appConfig.Name,
+				Upstreams:   appConfig.UpstreamServers,
+				Available:   appConfig.Available,
+				TLS:         appConfig.Certificates[domain] != nil,
+				Whitelist:   appWhitelist(routerConfig, appConfig),
+				Maintenance: appConfig.Maintenance,
+			}
+			for _, location := range appConfig.Locations {
+				if len(location.Whitelist) == 0 && location.Backend == "" {
+					continue
+				}
+				routeLoc := &routeLocation{
+					Path:      location.Path,
+					Backend:   location.Backend,
+					Upstreams: location.UpstreamServers,
+					Available: appConfig.Available,
+					Whitelist: rt.Whitelist,
+				}
+				if len(location.Whitelist) > 0 {
+					routeLoc.Whitelist = location.Whitelist
+				}
+				if location.Backend != "" {
+					routeLoc.Available = location.Available
+				}
+				rt.Locations = append(rt.Locations, routeLoc)
+			}
+			if rt.Upstreams == nil {
+				rt.Upstreams = []string{}
+			}
+			routes = append(routes, rt)
+		}
+	}
+	for _, passthroughConfig := range routerConfig.PassthroughConfigs {
+		for _, domain := range passthroughConfig.Domains {
+			routes = append(routes, &route{
+				Domain:      domain,
+				App:         passthroughConfig.Name,
+				Upstreams:   []string{fmt.Sprintf("%s:%d", passthroughConfig.ServiceIP, passthroughConfig.TargetPort)},
+				Available:   true,
+				TLS:         true,
+				Passthrough: true,
+			})
+		}
+	}
+	sort.Stable(routesByDomain(routes))
+	return routes
+}
+
+// appWhitelist returns the addresses permitted to access the given app, or nil if access isn't
+// restricted.  An empty whitelist that is enforced denies access to everyone.
+func appWhitelist(routerConfig *model.RouterConfig, appConfig *model.AppConfig) []string {
+	if !routerConfig.EnforceWhitelists && len(routerConfig.DefaultWhitelist) == 0 && len(appConfig.Whitelist) == 0 {
+		return nil
+	}
+	whitelist := []string{}
+	if len(appConfig.Whitelist) == 0 || routerConfig.WhitelistMode == "extend" {
+		whitelist = append(whitelist, routerConfig.DefaultWhitelist...)
+	}
+	return append(whitelist, appConfig.Whitelist...)
+}
+
+// routeDomain returns the domain as nginx matches it.  Domains that aren't fully qualified are
+// subdomains of the platform domain or, if there is none, of any domain.
+func routeDomain(routerConfig *model.RouterConfig, domain string) string {
+	if strings.Contains(domain, ".") {
+		return domain
+	}
+	if routerConfig.PlatformDomain != "" {
+		return domain + "." + routerConfig.PlatformDomain
+	}
+	return domain + ".*"
+}
+
+type routesByDomain []*route
+
+func (r routesByDomain) Len() int           { return len(r) }
+func (r routesByDomain) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r routesByDomain) Less(i, j int) bool { return r[i].Domain < r[j].Domain }
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/deis/router/model"
+)
+
+func TestPurgeCache(t *testing.T) {
+	zonePath, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(zonePath)
+	cacheFilePath := filepath.Join(zonePath, "c", "29", "a1b2c29")
+	if err := os.MkdirAll(filepath.Dir(cacheFilePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(cacheFilePath, []byte("header\nKEY: foo/bar|httpGETfoo.example.com/\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer()
+	s.SetRouterConfig(&model.RouterConfig{
+		CacheZoneConfigs: []*model.CacheZone{{Name: "api", Path: zonePath, Size: "100m", Inactive: "60m"}},
+		AppConfigs: []*model.AppConfig{
+			{Name: "foo/bar", Nginx: &model.NginxAppConfig{CacheConfig: &model.CacheConfig{Enabled: true, Zone: "api"}}},
+			{Name: "foo/baz", Nginx: &model.NginxAppConfig{CacheConfig: &model.CacheConfig{}}},
+		},
+	})
+
+	testCases := []struct {
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{"GET", "/cache/foo/bar", http.StatusMethodNotAllowed},
+		{"DELETE", "/cache/foo/qux", http.StatusNotFound},
+		// Apps that haven't opted into caching have no cache to purge.
+		{"DELETE", "/cache/foo/baz", http.StatusNotFound},
+		{"DELETE", "/cache/foo/bar", http.StatusOK},
+	}
+	for _, testCase := range testCases {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(testCase.method, testCase.path, nil))
+		if w.Code != testCase.expectedStatus {
+			t.Errorf("Expected %s %s to respond with %d, but got %d", testCase.method, testCase.path, testCase.expectedStatus, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	if err := ioutil.WriteFile(cacheFilePath, []byte("header\nKEY: foo/bar|httpGETfoo.example.com/\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s.ServeHTTP(w, httptest.NewRequest("DELETE", "/cache/foo/bar", nil))
+	var body struct {
+		App    string `json:"app"`
+		Purged int    `json:"purged"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.App != "foo/bar" || body.Purged != 1 {
+		t.Errorf("Expected 1 purged response for app foo/bar, but got %+v", body)
+	}
+	if _, err := os.Stat(cacheFilePath); !os.IsNotExist(err) {
+		t.Errorf("Expected the cached response to be removed.")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	s := NewServer()
+	s.SetRouterConfig(&model.RouterConfig{
+		PlatformCertificate: &model.Certificate{Cert: "foo", Key: "bar"},
+		RejectedAnnotations: []*model.RejectedAnnotation{{Kind: "Service", Namespace: "foo", Name: "bar", Key: "router.deis.io/connectTimeout", Value: "soon"}},
+	})
+	s.SetBuildResult(errors.New("boom"))
+	s.SetBuildResult(nil)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/config", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected GET /config to respond with %d, but got %d", http.StatusOK, w.Code)
+	}
+	var body struct {
+		RouterConfig struct {
+			PlatformCertificate struct {
+				Cert string
+				Key  string
+			}
+		} `json:"routerConfig"`
+		LastBuild *string `json:"lastBuild"`
+		LastError *struct {
+			Message string `json:"message"`
+		} `json:"lastError"`
+		RejectedAnnotations []struct {
+			Key string
+		} `json:"rejectedAnnotations"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.RouterConfig.PlatformCertificate.Cert != "foo" || body.RouterConfig.PlatformCertificate.Key != "REDACTED" {
+		t.Errorf("Expected the platform certificate with its key redacted, but got %+v", body.RouterConfig.PlatformCertificate)
+	}
+	if body.LastBuild == nil {
+		t.Errorf("Expected the time of the last build.")
+	}
+	// A successful build doesn't clear the last error.
+	if body.LastError == nil || body.LastError.Message != "boom" {
+		t.Errorf("Expected the last error to be \"boom\", but got %+v", body.LastError)
+	}
+	if len(body.RejectedAnnotations) != 1 || body.RejectedAnnotations[0].Key != "router.deis.io/connectTimeout" {
+		t.Errorf("Expected the rejected annotation router.deis.io/connectTimeout, but got %+v", body.RejectedAnnotations)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	routerConfig := &model.RouterConfig{
+		PlatformDomain:   "example.com",
+		DefaultWhitelist: []string{"10.0.0.0/8"},
+		WhitelistMode:    "extend",
+		AppConfigs: []*model.AppConfig{
+			{
+				Name:            "foo",
+				Domains:         []string{"foo", "foo.example.org"},
+				Whitelist:       []string{"1.2.3.4"},
+				UpstreamServers: []string{"10.1.1.1:80"},
+				Available:       true,
+				Certificates:    map[string]*model.Certificate{"foo.example.org": {Cert: "foo", Key: "bar"}},
+				Locations:       []*model.Location{{Path: "/"}, {Path: "/admin", Whitelist: []string{"10.0.0.0/8", "1.2.3.4", "5.6.7.8"}}},
+			},
+		},
+		PassthroughConfigs: []*model.PassthroughConfig{{Name: "bar", Domains: []string{"bar.example.org"}, ServiceIP: "10.1.1.2", TargetPort: 8443}},
+	}
+	expected := []*route{
+		{Domain: "bar.example.org", App: "bar", Upstreams: []string{"10.1.1.2:8443"}, Available: true, TLS: true, Passthrough: true},
+		{
+			Domain:    "foo.example.com",
+			App:       "foo",
+			Upstreams: []string{"10.1.1.1:80"},
+			Available: true,
+			Whitelist: []string{"10.0.0.0/8", "1.2.3.4"},
+			Locations: []*routeLocation{{Path: "/admin", Available: true, Whitelist: []string{"10.0.0.0/8", "1.2.3.4", "5.6.7.8"}}},
+		},
+		{
+			Domain:    "foo.example.org",
+			App:       "foo",
+			Upstreams: []string{"10.1.1.1:80"},
+			Available: true,
+			TLS:       true,
+			Whitelist: []string{"10.0.0.0/8", "1.2.3.4"},
+			Locations: []*routeLocation{{Path: "/admin", Available: true, Whitelist: []string{"10.0.0.0/8", "1.2.3.4", "5.6.7.8"}}},
+		},
+	}
+	if actual := buildRoutes(routerConfig); !reflect.DeepEqual(expected, actual) {
+		actualJSON, _ := json.Marshal(actual)
+		t.Errorf("Expected routes did not match actual routes: %s", actualJSON)
+	}
+
+	// Without any whitelists, access isn't restricted.
+	routerConfig.DefaultWhitelist = nil
+	routerConfig.AppConfigs[0].Whitelist = nil
+	if actual := buildRoutes(routerConfig); actual[1].Whitelist != nil {
+		t.Errorf("Expected no whitelist, but got %v", actual[1].Whitelist)
+	}
+}
@@ -0,0 +1,249 @@
+// Package logs consumes the access and error logs nginx writes to the log pipe and forwards them,
+// as structured records, to the configured sinks.
+package logs
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/deis/router/model"
+)
+
+// maxBatchSize is the most records written to the sinks at once.
+const maxBatchSize = 100
+
+// Forwarder reads log lines from nginx and forwards them to its sinks.  Reading never waits on the
+// sinks: records are buffered, and once the buffer is full, records are dropped according to the
+// configured drop policy.
+type Forwarder struct {
+	mutex       sync.Mutex
+	cond        *sync.Cond
+	queue       []*Record
+	closed      bool
+	dropped     int
+	bufferSize  int
+	dropPolicy  string
+	config      *model.LogForwardingConfig
+	sinks       []sink
+	retired     []sink
+	writing     bool
+	sampleRates map[string]float64
+	random      func() float64
+	stdout      io.Writer
+}
+
+// NewForwarder returns a pointer to a new Forwarder that, until configured otherwise, writes
+// records to stdout.
+func NewForwarder() *Forwarder {
+	f := &Forwarder{
+		bufferSize:  10000,
+		dropPolicy:  "newest",
+		sinks:       []sink{newWriterSink(os.Stdout)},
+		sampleRates: map[string]float64{},
+		random:      rand.Float64,
+		stdout:      os.Stdout,
+	}
+	f.cond = sync.NewCond(&f.mutex)
+	return f
+}
+
+// OpenPipe creates the named pipe nginx logs to, if it doesn't already exist, and opens it for
+// reading.  The pipe is also opened for writing so that opening it doesn't wait for nginx and
+// reading it never reaches EOF when nginx closes its end, e.g. while reloading.
+func OpenPipe(path string) (*os.File, error) {
+	if err := syscall.Mkfifo(path, 0600); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_RDWR, 0)
+}
+
+// SetRouterConfig applies the log forwarding configuration and per-app sampling rates from the
+// given router configuration.
+func (f *Forwarder) SetRouterConfig(routerConfig *model.RouterConfig) {
+	sampleRates := map[string]float64{}
+	for _, appConfig := range routerConfig.AppConfigs {
+		sampleRate, err := strconv.ParseFloat(appConfig.LogSampleRate, 64)
+		if err == nil && sampleRate < 1 {
+			sampleRates[appConfig.Name] = sampleRate
+		}
+	}
+	f.mutex.Lock()
+	f.sampleRates = sampleRates
+	f.mutex.Unlock()
+	if routerConfig.LogForwardingConfig != nil {
+		f.configure(routerConfig.LogForwardingConfig)
+	}
+}
+
+// configure replaces the Forwarder's sinks and buffering if the given configuration differs from
+// that already applied.  Sinks that can't be set up are skipped.  The replaced sinks are closed
+// once any batch of records being written to them has been written.
+func (f *Forwarder) configure(config *model.LogForwardingConfig) {
+	f.mutex.Lock()
+	unchanged := reflect.DeepEqual(config, f.config)
+	f.mutex.Unlock()
+	if unchanged {
+		return
+	}
+	sinks := []sink{}
+	for _, name := range config.Sinks {
+		switch name {
+		case "stdout":
+			sinks = append(sinks, newWriterSink(f.stdout))
+		case "syslog":
+			if config.SyslogAddress == "" {
+				log.Printf("WARN: Not forwarding logs to syslog because no syslog address was specified.\n")
+				continue
+			}
+			syslogSink, err := newSyslogSink(config.SyslogAddress)
+			if err != nil {
+				log.Printf("WARN: Not forwarding logs to syslog at %s: %v.\n", config.SyslogAddress, err)
+				continue
+			}
+			sinks = append(sinks, syslogSink)
+		case "http":
+			if config.HTTPURL == "" {
+				log.Printf("WARN: Not forwarding logs over HTTP because no URL was specified.\n")
+				continue
+			}
+			sinks = append(sinks, newHTTPSink(config.HTTPURL))
+		}
+	}
+	f.mutex.Lock()
+	oldSinks := f.sinks
+	f.config = config
+	f.sinks = sinks
+	f.bufferSize = config.BufferSize
+	f.dropPolicy = config.DropPolicy
+	if excess := len(f.queue) - f.bufferSize; excess > 0 {
+		f.dropped += excess
+		if f.dropPolicy == "oldest" {
+			f.queue = f.queue[excess:]
+		} else {
+			f.queue = f.queue[:f.bufferSize]
+		}
+	}
+	if f.writing {
+		f.retired = append(f.retired, oldSinks...)
+		oldSinks = nil
+	}
+	f.mutex.Unlock()
+	closeSinks(oldSinks)
+}
+
+// closeSinks closes each of the given sinks.
+func closeSinks(sinks []sink) {
+	for _, sink := range sinks {
+		sink.close()
+	}
+}
+
+// Run reads log lines from r until it is exhausted, forwarding each as a structured record.  It
+// returns once all buffered records have been written to the sinks.
+func (f *Forwarder) Run(r io.Reader) error {
+	done := make(chan struct{})
+	go f.drain(done)
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			f.forward(parseLine(line))
+		}
+		if err != nil {
+			f.mutex.Lock()
+			f.closed = true
+			f.cond.Signal()
+			f.mutex.Unlock()
+			<-done
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// forward buffers the given record unless it is an access log entry excluded by its app's
+// sampling rate.  If the buffer is full, either the given record or the oldest buffered record is
+// dropped.
+func (f *Forwarder) forward(record *Record) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if sampleRate, ok := f.sampleRates[record.App]; ok && record.Type == "access" && f.random() >= sampleRate {
+		return
+	}
+	if len(f.queue) >= f.bufferSize {
+		f.dropped++
+		if f.dropPolicy != "oldest" {
+			return
+		}
+		f.queue = f.queue[1:]
+	}
+	f.queue = append(f.queue, record)
+	f.cond.Signal()
+}
+
+// drain writes buffered records to the sinks until the Forwarder is closed and its buffer is
+// empty.
+func (f *Forwarder) drain(done chan struct{}) {
+	defer close(done)
+	for {
+		records, sinks, dropped := f.next()
+		if dropped > 0 {
+			log.Printf("WARN: Dropped %d log records because the log buffer was full.\n", dropped)
+		}
+		if records == nil {
+			return
+		}
+		for _, sink := range sinks {
+			if err := sink.write(records); err != nil {
+				log.Printf("WARN: Unable to forward %d log records: %v.\n", len(records), err)
+			}
+		}
+		closeSinks(f.finishBatch())
+	}
+}
+
+// finishBatch records that the batch returned by next has been written and returns the sinks
+// replaced while it was being written, which can now be closed.
+func (f *Forwarder) finishBatch() []sink {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	retired := f.retired
+	f.retired = nil
+	f.writing = false
+	return retired
+}
+
+// next waits for records to be buffered and removes up to maxBatchSize of them from the buffer.
+// It also returns the sinks to write them to and the number of records dropped since it was last
+// called.  It returns no records once the Forwarder is closed and its buffer is empty.  Until
+// finishBatch is called, the returned sinks are not closed if they are replaced.
+func (f *Forwarder) next() ([]*Record, []sink, int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for len(f.queue) == 0 && !f.closed {
+		f.cond.Wait()
+	}
+	dropped := f.dropped
+	f.dropped = 0
+	if len(f.queue) == 0 {
+		return nil, nil, dropped
+	}
+	n := len(f.queue)
+	if n > maxBatchSize {
+		n = maxBatchSize
+	}
+	records := append([]*Record(nil), f.queue[:n]...)
+	f.queue = f.queue[n:]
+	f.writing = true
+	return records, f.sinks, dropped
+}
@@ -0,0 +1,178 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/deis/router/model"
+)
+
+func TestForwarder(t *testing.T) {
+	var mutex sync.Mutex
+	var posted []*Record
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var records []*Record
+		if err := json.NewDecoder(r.Body).Decode(&records); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		mutex.Lock()
+		posted = append(posted, records...)
+		mutex.Unlock()
+	}))
+	defer collector.Close()
+
+	var stdout bytes.Buffer
+	f := NewForwarder()
+	f.stdout = &stdout
+	f.random = func() float64 { return 0.5 }
+	f.SetRouterConfig(&model.RouterConfig{
+		LogForwardingConfig: &model.LogForwardingConfig{Sinks: []string{"stdout", "http"}, HTTPURL: collector.URL, BufferSize: 100, DropPolicy: "newest"},
+		AppConfigs: []*model.AppConfig{
+			{Name: "foo/bar", LogSampleRate: "0.25"},
+			{Name: "foo/baz", LogSampleRate: "0.75"},
+			{Name: "foo/qux", LogSampleRate: "1"},
+		},
+	})
+
+	lines := []string{
+		`{"app_name":"foo/bar","status":"200"}`,
+		`{"app_name":"foo/baz","status":"200"}`,
+		`{"app_name":"foo/qux","status":"200"}`,
+		`2017/01/02 03:04:05 [error] 1#1: *1 upstream timed out, client: 1.2.3.4`,
+	}
+	if err := f.Run(strings.NewReader(strings.Join(lines, "\n"))); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Access logs for foo/bar are sampled out; error logs are never sampled.
+	expectedApps := []string{"foo/baz", "foo/qux", ""}
+	output := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(output) != len(expectedApps) {
+		t.Fatalf("Expected %d records on stdout, but got %d: %v", len(expectedApps), len(output), output)
+	}
+	for i, line := range output {
+		record := &Record{}
+		if err := json.Unmarshal([]byte(line), record); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if record.App != expectedApps[i] {
+			t.Errorf("Expected record %d to be for app %q, but got %+v", i, expectedApps[i], record)
+		}
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(posted) != len(expectedApps) || posted[2].Type != "error" || posted[2].Fields["client"] != "1.2.3.4" {
+		t.Errorf("Unexpected records posted to the collector: %v", posted)
+	}
+}
+
+func TestForwarderDropPolicy(t *testing.T) {
+	for _, test := range []struct {
+		dropPolicy string
+		expected   []string
+	}{
+		{"newest", []string{"1", "2"}},
+		{"oldest", []string{"2", "3"}},
+	} {
+		f := NewForwarder()
+		f.configure(&model.LogForwardingConfig{BufferSize: 2, DropPolicy: test.dropPolicy})
+		for _, message := range []string{"1", "2", "3"} {
+			f.forward(&Record{Type: "access", Message: message})
+		}
+		records, _, dropped := f.next()
+		if dropped != 1 {
+			t.Errorf("Expected 1 record to be dropped with drop policy %s, but got %d", test.dropPolicy, dropped)
+		}
+		messages := []string{}
+		for _, record := range records {
+			messages = append(messages, record.Message)
+		}
+		if strings.Join(messages, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("Expected records %v with drop policy %s, but got %v", test.expected, test.dropPolicy, messages)
+		}
+	}
+}
+
+// testSink records whether it has been closed.
+type testSink struct {
+	closed bool
+}
+
+func (s *testSink) write(records []*Record) error {
+	return nil
+}
+
+func (s *testSink) close() error {
+	s.closed = true
+	return nil
+}
+
+func TestForwarderReconfigureWhileWriting(t *testing.T) {
+	oldSink := &testSink{}
+	f := NewForwarder()
+	f.sinks = []sink{oldSink}
+	f.forward(&Record{Type: "access", Message: "1"})
+	_, sinks, _ := f.next()
+
+	// The sinks a batch is being written to stay open until the batch has been written.
+	f.configure(&model.LogForwardingConfig{BufferSize: 10, DropPolicy: "newest"})
+	if len(sinks) != 1 || sinks[0] != oldSink || oldSink.closed {
+		t.Errorf("Expected the sink being written to to stay open, but got %v", sinks)
+	}
+	closeSinks(f.finishBatch())
+	if !oldSink.closed {
+		t.Error("Expected the replaced sink to be closed once the batch was written")
+	}
+
+	// Sinks replaced between batches are closed right away.
+	newSink := &testSink{}
+	f.sinks = []sink{newSink}
+	f.configure(&model.LogForwardingConfig{Sinks: []string{"stdout"}, BufferSize: 10, DropPolicy: "newest"})
+	if !newSink.closed {
+		t.Error("Expected the replaced sink to be closed")
+	}
+}
+
+func TestOpenPipe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "router")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "logpipe")
+
+	pipe, err := OpenPipe(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer pipe.Close()
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+		t.Fatalf("Expected %s to be a named pipe", path)
+	}
+	writer, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	writer.Write([]byte("foo\n"))
+	writer.Close()
+	buf := make([]byte, 4)
+	if _, err := pipe.Read(buf); err != nil || string(buf) != "foo\n" {
+		t.Errorf("Expected to read what was written to the pipe, but got %q (%v)", buf, err)
+	}
+
+	// Opening an existing pipe reuses it.
+	reopened, err := OpenPipe(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	reopened.Close()
+}
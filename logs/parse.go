@@ -0,0 +1,122 @@
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Record is a single structured access or error log entry.
+type Record struct {
+	// Type is "access" or "error".
+	Type string `json:"type"`
+	// Time is when nginx logged the entry, in RFC 3339 format, if it could be determined.
+	Time string `json:"time,omitempty"`
+	// App is the name of the app that served the request, if known.
+	App string `json:"app,omitempty"`
+	// Level is the severity of an error log entry.
+	Level string `json:"level,omitempty"`
+	// Message is the text of an error log entry, or the raw line of an entry that couldn't be
+	// parsed.
+	Message string `json:"message,omitempty"`
+	// Fields holds the values of the nginx variables in an access log entry, or the context, e.g.
+	// client and request, of an error log entry.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// textAccessLogFields are the fields of the router's default text access log format, in order.
+var textAccessLogFields = []string{
+	"time_iso8601",
+	"app_name",
+	"remote_addr",
+	"remote_user",
+	"status",
+	"request",
+	"bytes_sent",
+	"http_referer",
+	"http_user_agent",
+	"server_name",
+	"upstream_addr",
+	"http_host",
+	"upstream_response_time",
+	"request_time",
+}
+
+// textAccessLogRegex matches lines in the router's default text access log format.
+var textAccessLogRegex = regexp.MustCompile(`^\[(\S+)\] - (\S*) - (\S*) - (.*?) - (\d{3}) - "([^"]*)" - (\d+) - "([^"]*)" - "([^"]*)" - "([^"]*)" - (.*?) - (\S*) - (.*?) - (\S*)$`)
+
+// errorLogRegex matches lines in nginx's error log format, e.g.
+// "2017/01/02 03:04:05 [error] 12#12: *34 connect() failed, client: 1.2.3.4".
+var errorLogRegex = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) \[(\w+)\] (\d+)#(\d+): (?:\*(\d+) )?(.*)$`)
+
+// errorLogContextRegex matches the "key: value" pairs nginx appends to error log messages.
+var errorLogContextRegex = regexp.MustCompile(`(\w+): ("(?:[^"\\]|\\.)*"|[^,]*)(?:, |$)`)
+
+const errorLogTimeFormat = "2006/01/02 15:04:05"
+
+// parseLine parses a line written by nginx to the log pipe.  Access log entries may be in the
+// router's JSON format or its default text format; entries in any other format are returned with
+// the raw line as their message.
+func parseLine(line string) *Record {
+	if matches := errorLogRegex.FindStringSubmatch(line); matches != nil {
+		return parseErrorLine(matches)
+	}
+	record := &Record{Type: "access", Fields: map[string]string{}}
+	if strings.HasPrefix(line, "{") {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err == nil {
+			for key, value := range fields {
+				if s, ok := value.(string); ok {
+					record.Fields[key] = s
+				} else {
+					record.Fields[key] = fmt.Sprint(value)
+				}
+			}
+			completeAccessRecord(record)
+			return record
+		}
+	}
+	if matches := textAccessLogRegex.FindStringSubmatch(line); matches != nil {
+		for i, field := range textAccessLogFields {
+			record.Fields[field] = matches[i+1]
+		}
+		completeAccessRecord(record)
+		return record
+	}
+	record.Message = line
+	record.Fields = nil
+	return record
+}
+
+// completeAccessRecord lifts the time and app name of an access log entry out of its fields.
+func completeAccessRecord(record *Record) {
+	record.Time = record.Fields["time_iso8601"]
+	if record.Fields["app_name"] != "-" {
+		record.App = record.Fields["app_name"]
+	}
+}
+
+func parseErrorLine(matches []string) *Record {
+	record := &Record{
+		Type:    "error",
+		Level:   matches[2],
+		Message: matches[6],
+		Fields:  map[string]string{"pid": matches[3], "tid": matches[4]},
+	}
+	if t, err := time.ParseInLocation(errorLogTimeFormat, matches[1], time.Local); err == nil {
+		record.Time = t.Format(time.RFC3339)
+	}
+	if matches[5] != "" {
+		record.Fields["connection"] = matches[5]
+	}
+	// nginx appends context to the message, starting with the client's address.
+	if i := strings.Index(record.Message, ", client: "); i >= 0 {
+		for _, pair := range errorLogContextRegex.FindAllStringSubmatch(record.Message[i+2:], -1) {
+			record.Fields[pair[1]] = strings.Trim(pair[2], `"`)
+		}
+		record.Message = record.Message[:i]
+	}
+	return record
+}
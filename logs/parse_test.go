@@ -0,0 +1,79 @@
+package logs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTextAccessLine(t *testing.T) {
+	line := `[2017-01-02T03:04:05+00:00] - foo/bar - 1.2.3.4 - - - 200 - "GET / HTTP/1.1" - 612 - "-" - "curl/7.50.1" - "foo.example.com" - 10.0.0.1:80 - foo.example.com - 0.002 - 0.003`
+	record := parseLine(line)
+	if record.Type != "access" || record.App != "foo/bar" || record.Time != "2017-01-02T03:04:05+00:00" {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+	expected := map[string]string{
+		"time_iso8601":           "2017-01-02T03:04:05+00:00",
+		"app_name":               "foo/bar",
+		"remote_addr":            "1.2.3.4",
+		"remote_user":            "-",
+		"status":                 "200",
+		"request":                "GET / HTTP/1.1",
+		"bytes_sent":             "612",
+		"http_referer":           "-",
+		"http_user_agent":        "curl/7.50.1",
+		"server_name":            "foo.example.com",
+		"upstream_addr":          "10.0.0.1:80",
+		"http_host":              "foo.example.com",
+		"upstream_response_time": "0.002",
+		"request_time":           "0.003",
+	}
+	if !reflect.DeepEqual(record.Fields, expected) {
+		t.Errorf("Expected fields %v, but got %v", expected, record.Fields)
+	}
+}
+
+func TestParseJSONAccessLine(t *testing.T) {
+	record := parseLine(`{"time_iso8601":"2017-01-02T03:04:05+00:00","app_name":"foo/bar","status":"502","upstream_addr":"10.0.0.1:80, 10.0.0.2:80"}`)
+	if record.Type != "access" || record.App != "foo/bar" || record.Time != "2017-01-02T03:04:05+00:00" {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+	if record.Fields["status"] != "502" || record.Fields["upstream_addr"] != "10.0.0.1:80, 10.0.0.2:80" {
+		t.Errorf("Unexpected fields: %v", record.Fields)
+	}
+}
+
+func TestParseUnknownAccessLine(t *testing.T) {
+	record := parseLine("1.2.3.4 - 200")
+	if record.Type != "access" || record.Message != "1.2.3.4 - 200" || record.Fields != nil {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+}
+
+func TestParseErrorLine(t *testing.T) {
+	line := `2017/01/02 03:04:05 [error] 12#13: *34 connect() failed (111: Connection refused) while connecting to upstream, client: 1.2.3.4, server: foo.example.com, request: "GET /a, b HTTP/1.1", upstream: "http://10.0.0.1:80/", host: "foo.example.com"`
+	record := parseLine(line)
+	if record.Type != "error" || record.Level != "error" || record.Time == "" {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+	if record.Message != "connect() failed (111: Connection refused) while connecting to upstream" {
+		t.Errorf("Unexpected message: %s", record.Message)
+	}
+	expected := map[string]string{
+		"pid":        "12",
+		"tid":        "13",
+		"connection": "34",
+		"client":     "1.2.3.4",
+		"server":     "foo.example.com",
+		"request":    "GET /a, b HTTP/1.1",
+		"upstream":   "http://10.0.0.1:80/",
+		"host":       "foo.example.com",
+	}
+	if !reflect.DeepEqual(record.Fields, expected) {
+		t.Errorf("Expected fields %v, but got %v", expected, record.Fields)
+	}
+
+	record = parseLine(`2017/01/02 03:04:05 [notice] 1#1: signal process started`)
+	if record.Level != "notice" || record.Message != "signal process started" || record.Fields["connection"] != "" {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+}
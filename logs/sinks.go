@@ -0,0 +1,125 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// sink is a destination to which log records are forwarded.
+type sink interface {
+	write(records []*Record) error
+	close() error
+}
+
+// writerSink writes each record as a line of JSON.
+type writerSink struct {
+	encoder *json.Encoder
+}
+
+func newWriterSink(w io.Writer) *writerSink {
+	return &writerSink{encoder: json.NewEncoder(w)}
+}
+
+func (s *writerSink) write(records []*Record) error {
+	for _, record := range records {
+		if err := s.encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *writerSink) close() error {
+	return nil
+}
+
+// syslogSink sends each record, as JSON, to a syslog server.  Error log entries are sent with the
+// corresponding syslog severity; access log entries are sent as informational.
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+// newSyslogSink connects to the syslog server at the given address, e.g. "udp://1.2.3.4:514".
+func newSyslogSink(address string) (*syslogSink, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := syslog.Dial(u.Scheme, u.Host, syslog.LOG_INFO|syslog.LOG_LOCAL0, "router")
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{writer: writer}, nil
+}
+
+func (s *syslogSink) write(records []*Record) error {
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		message := string(data)
+		switch record.Level {
+		case "emerg":
+			err = s.writer.Emerg(message)
+		case "alert":
+			err = s.writer.Alert(message)
+		case "crit":
+			err = s.writer.Crit(message)
+		case "error":
+			err = s.writer.Err(message)
+		case "warn":
+			err = s.writer.Warning(message)
+		case "notice":
+			err = s.writer.Notice(message)
+		case "debug":
+			err = s.writer.Debug(message)
+		default:
+			err = s.writer.Info(message)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syslogSink) close() error {
+	return s.writer.Close()
+}
+
+// httpSink posts each batch of records to an HTTP collector as a JSON array.
+type httpSink struct {
+	url        string
+	httpClient *http.Client
+}
+
+func newHTTPSink(url string) *httpSink {
+	return &httpSink{url: url, httpClient: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (s *httpSink) write(records []*Record) error {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	resp, err := s.httpClient.Post(s.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) close() error {
+	return nil
+}
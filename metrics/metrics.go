@@ -0,0 +1,225 @@
+// Package metrics exports metrics about the router itself, and the per-app traffic statistics
+// nginx collects, in the Prometheus text exposition format.
+package metrics
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deis/router/model"
+)
+
+// reconcileDurationBuckets are the upper bounds, in seconds, of the reconcile duration
+// histogram's buckets.
+var reconcileDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Collector accumulates the router's metrics and serves them, together with nginx's traffic
+// statistics, in response to scrapes.
+type Collector struct {
+	mutex                sync.Mutex
+	statsURL             string
+	httpClient           *http.Client
+	reconciles           map[string]float64
+	reconcileBuckets     []float64
+	reconcileDurationSum float64
+	reconcileCount       float64
+	buildErrors          float64
+	reloads              map[string]float64
+	apps                 float64
+	domains              float64
+	certificateExpiries  map[string]float64
+}
+
+// NewCollector returns a pointer to a new Collector that reads nginx's traffic statistics, in
+// the VTS module's JSON format, from the given URL.
+func NewCollector(statsURL string) *Collector {
+	return &Collector{
+		statsURL:            statsURL,
+		httpClient:          &http.Client{Timeout: 5 * time.Second},
+		reconciles:          map[string]float64{},
+		reconcileBuckets:    make([]float64, len(reconcileDurationBuckets)),
+		reloads:             map[string]float64{},
+		certificateExpiries: map[string]float64{},
+	}
+}
+
+// ObserveReconcile records one pass of the router's main loop.  The result is "unchanged" if the
+// configuration in k8s hadn't changed, "applied" if new configuration was applied to nginx, or
+// "failed" otherwise.
+func (c *Collector) ObserveReconcile(result string, duration time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.reconciles[result]++
+	seconds := duration.Seconds()
+	for i, bound := range reconcileDurationBuckets {
+		if seconds <= bound {
+			c.reconcileBuckets[i]++
+		}
+	}
+	c.reconcileDurationSum += seconds
+	c.reconcileCount++
+}
+
+// ObserveBuildError records a failure to build router configuration from k8s.
+func (c *Collector) ObserveBuildError() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.buildErrors++
+}
+
+// ObserveReload records an attempt to reload nginx and the error, if any, it resulted in.
+func (c *Collector) ObserveReload(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err != nil {
+		c.reloads["failure"]++
+	} else {
+		c.reloads["success"]++
+	}
+}
+
+// SetRouterConfig records metrics describing the router configuration most recently applied to
+// nginx.
+func (c *Collector) SetRouterConfig(routerConfig *model.RouterConfig) {
+	domains := 0
+	for _, appConfig := range routerConfig.AppConfigs {
+		domains += len(appConfig.Domains)
+	}
+	for _, passthroughConfig := range routerConfig.PassthroughConfigs {
+		domains += len(passthroughConfig.Domains)
+	}
+	certificateExpiries := buildCertificateExpiries(routerConfig)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.apps = float64(len(routerConfig.AppConfigs))
+	c.domains = float64(domains)
+	c.certificateExpiries = certificateExpiries
+}
+
+// buildCertificateExpiries returns the expiry, as a Unix timestamp, of each of the router's
+// certificates, keyed by the name the router writes the certificate under, e.g. "platform",
+// "foo.example.com", or "backends/foo/client".
+func buildCertificateExpiries(routerConfig *model.RouterConfig) map[string]float64 {
+	certificates := map[string]*model.Certificate{}
+	if routerConfig.PlatformCertificate != nil {
+		certificates["platform"] = routerConfig.PlatformCertificate
+	}
+	for _, appConfig := range routerConfig.AppConfigs {
+		for domain, certificate := range appConfig.Certificates {
+			// Domains that aren't fully qualified use the platform certificate.
+			if certificate != nil && strings.Contains(domain, ".") {
+				certificates[domain] = certificate
+			}
+		}
+		if appConfig.BackendTLSConfig != nil && appConfig.BackendTLSConfig.ClientCertificate != nil {
+			certificates[filepath.Join("backends", appConfig.Name, "client")] = appConfig.BackendTLSConfig.ClientCertificate
+		}
+	}
+	expiries := map[string]float64{}
+	for name, certificate := range certificates {
+		notAfter, err := certificateExpiry(certificate.Cert)
+		if err != nil {
+			log.Printf("WARN: Unable to determine when the %s certificate expires: %v.\n", name, err)
+			continue
+		}
+		expiries[name] = float64(notAfter.Unix())
+	}
+	return expiries
+}
+
+// certificateExpiry returns when the first certificate in the given PEM-encoded chain expires.
+func certificateExpiry(cert string) (time.Time, error) {
+	block, _ := pem.Decode([]byte(cert))
+	if block == nil {
+		return time.Time{}, fmt.Errorf("no PEM data found")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return certificate.NotAfter, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	c.writeRouterMetrics(w)
+	stats, err := c.fetchStats()
+	if err != nil {
+		log.Printf("WARN: Unable to read nginx traffic statistics: %v.\n", err)
+	}
+	writeStatsMetrics(w, stats)
+}
+
+func (c *Collector) writeRouterMetrics(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	writeHeader(w, "router_reconciles_total", "counter", "Passes of the router's main loop, by result.")
+	for _, result := range []string{"applied", "failed", "unchanged"} {
+		writeSample(w, "router_reconciles_total", []string{"result", result}, c.reconciles[result])
+	}
+	writeHeader(w, "router_reconcile_duration_seconds", "histogram", "Time taken by passes of the router's main loop.")
+	for i, bound := range reconcileDurationBuckets {
+		writeSample(w, "router_reconcile_duration_seconds_bucket", []string{"le", formatValue(bound)}, c.reconcileBuckets[i])
+	}
+	writeSample(w, "router_reconcile_duration_seconds_bucket", []string{"le", "+Inf"}, c.reconcileCount)
+	writeSample(w, "router_reconcile_duration_seconds_sum", nil, c.reconcileDurationSum)
+	writeSample(w, "router_reconcile_duration_seconds_count", nil, c.reconcileCount)
+	writeHeader(w, "router_build_errors_total", "counter", "Failures to build router configuration from k8s.")
+	writeSample(w, "router_build_errors_total", nil, c.buildErrors)
+	writeHeader(w, "router_reloads_total", "counter", "Attempts to reload nginx, by result.")
+	for _, result := range []string{"success", "failure"} {
+		writeSample(w, "router_reloads_total", []string{"result", result}, c.reloads[result])
+	}
+	writeHeader(w, "router_apps", "gauge", "Apps in the router configuration applied to nginx.")
+	writeSample(w, "router_apps", nil, c.apps)
+	writeHeader(w, "router_domains", "gauge", "Domains in the router configuration applied to nginx.")
+	writeSample(w, "router_domains", nil, c.domains)
+	writeHeader(w, "router_certificate_expiry_timestamp_seconds", "gauge", "When each of the router's certificates expires.")
+	for _, name := range sortedKeys(c.certificateExpiries) {
+		writeSample(w, "router_certificate_expiry_timestamp_seconds", []string{"certificate", name}, c.certificateExpiries[name])
+	}
+}
+
+func writeHeader(w io.Writer, name string, metricType string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// writeSample writes one sample of the named metric.  labels holds alternating label names and
+// values.
+func writeSample(w io.Writer, name string, labels []string, value float64) {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], labelValueReplacer.Replace(labels[i+1])))
+	}
+	if len(pairs) > 0 {
+		fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(pairs, ","), formatValue(value))
+	} else {
+		fmt.Fprintf(w, "%s %s\n", name, formatValue(value))
+	}
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
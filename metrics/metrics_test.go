@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deis/router/model"
+)
+
+const testStats = `{
+	"connections": {"active": 3, "reading": 0, "writing": 1, "waiting": 2, "accepted": 100, "handled": 99},
+	"serverZones": {"*": {"requestCounter": 50}},
+	"filterZones": {
+		"application::*": {
+			"foo/bar": {"requestCounter": 42, "inBytes": 1024, "outBytes": 4096, "responses": {"1xx": 0, "2xx": 40, "3xx": 0, "4xx": 1, "5xx": 1}, "requestMsec": 250}
+		}
+	}
+}`
+
+func TestCollector(t *testing.T) {
+	statsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testStats)
+	}))
+	defer statsServer.Close()
+	notAfter := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	c := NewCollector(statsServer.URL)
+	c.ObserveReconcile("applied", 200*time.Millisecond)
+	c.ObserveReconcile("unchanged", 20*time.Millisecond)
+	c.ObserveBuildError()
+	c.ObserveReload(nil)
+	c.ObserveReload(errors.New("boom"))
+	c.ObserveReload(nil)
+	c.SetRouterConfig(&model.RouterConfig{
+		PlatformCertificate: &model.Certificate{Cert: newTestCert(t, notAfter)},
+		AppConfigs: []*model.AppConfig{
+			{Name: "foo/bar", Domains: []string{"foo", "foo.example.com"}, Certificates: map[string]*model.Certificate{"foo": nil}},
+			{Name: "foo/baz", Domains: []string{"baz.example.com"}, Certificates: map[string]*model.Certificate{"baz.example.com": {Cert: "garbage"}}},
+		},
+	})
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	expectations := []string{
+		`router_reconciles_total{result="applied"} 1`,
+		`router_reconciles_total{result="failed"} 0`,
+		`router_reconciles_total{result="unchanged"} 1`,
+		`router_reconcile_duration_seconds_bucket{le="0.05"} 1`,
+		`router_reconcile_duration_seconds_bucket{le="0.25"} 2`,
+		`router_reconcile_duration_seconds_bucket{le="+Inf"} 2`,
+		`router_reconcile_duration_seconds_count 2`,
+		`router_build_errors_total 1`,
+		`router_reloads_total{result="success"} 2`,
+		`router_reloads_total{result="failure"} 1`,
+		`router_apps 2`,
+		`router_domains 3`,
+		fmt.Sprintf(`router_certificate_expiry_timestamp_seconds{certificate="platform"} %d`, notAfter.Unix()),
+		`router_nginx_up 1`,
+		`router_nginx_connections{state="active"} 3`,
+		`router_nginx_connections_total{outcome="accepted"} 100`,
+		`router_app_requests_total{app="foo/bar"} 42`,
+		`router_app_responses_total{app="foo/bar",code="2xx"} 40`,
+		`router_app_responses_total{app="foo/bar",code="5xx"} 1`,
+		`router_app_received_bytes_total{app="foo/bar"} 1024`,
+		`router_app_sent_bytes_total{app="foo/bar"} 4096`,
+		`router_app_request_time_seconds{app="foo/bar"} 0.25`,
+	}
+	for _, expectation := range expectations {
+		if !strings.Contains(body, expectation+"\n") {
+			t.Errorf("Expected the metrics to include %s, but they did not.", expectation)
+		}
+	}
+	// Certificates that can't be parsed are left out.
+	if strings.Contains(body, `certificate="baz.example.com"`) {
+		t.Errorf("Expected no expiry for an invalid certificate.")
+	}
+}
+
+func TestCollectorWithoutStats(t *testing.T) {
+	statsServer := httptest.NewServer(http.NotFoundHandler())
+	defer statsServer.Close()
+
+	c := NewCollector(statsServer.URL)
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	if !strings.Contains(body, "router_nginx_up 0\n") {
+		t.Errorf("Expected nginx to be reported down.")
+	}
+	if !strings.Contains(body, "router_build_errors_total 0\n") {
+		t.Errorf("Expected the router's own metrics regardless.")
+	}
+	if strings.Contains(body, "router_app_requests_total") {
+		t.Errorf("Expected no app metrics.")
+	}
+}
+
+func TestWriteSampleEscaping(t *testing.T) {
+	var b bytes.Buffer
+	writeSample(&b, "foo", []string{"bar", "a\"b\\c\nd"}, 1.5)
+	expected := "foo{bar=\"a\\\"b\\\\c\\nd\"} 1.5\n"
+	if b.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, b.String())
+	}
+}
+
+func newTestCert(t *testing.T, notAfter time.Time) string {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    notAfter.Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
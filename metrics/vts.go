@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// appFilterGroup is the VTS filter group under which nginx counts each app's traffic, keyed by
+// app name.
+const appFilterGroup = "application::*"
+
+// responseClasses are the classes of response status VTS counts.
+var responseClasses = []string{"1xx", "2xx", "3xx", "4xx", "5xx"}
+
+// vtsStats is the subset of the VTS module's JSON status the router exports.
+type vtsStats struct {
+	Connections struct {
+		Active   float64 `json:"active"`
+		Reading  float64 `json:"reading"`
+		Writing  float64 `json:"writing"`
+		Waiting  float64 `json:"waiting"`
+		Accepted float64 `json:"accepted"`
+		Handled  float64 `json:"handled"`
+	} `json:"connections"`
+	FilterZones map[string]map[string]*vtsZone `json:"filterZones"`
+}
+
+// vtsZone holds the traffic counters VTS keeps for a server or filter zone.
+type vtsZone struct {
+	RequestCounter float64            `json:"requestCounter"`
+	InBytes        float64            `json:"inBytes"`
+	OutBytes       float64            `json:"outBytes"`
+	Responses      map[string]float64 `json:"responses"`
+	RequestMsec    float64            `json:"requestMsec"`
+}
+
+func (c *Collector) fetchStats() (*vtsStats, error) {
+	resp, err := c.httpClient.Get(c.statsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	stats := &vtsStats{}
+	if err := json.NewDecoder(resp.Body).Decode(stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// writeStatsMetrics translates nginx's traffic statistics into labelled metrics.  If stats is nil,
+// only the fact that nginx's statistics are unavailable is written.
+func writeStatsMetrics(w io.Writer, stats *vtsStats) {
+	writeHeader(w, "router_nginx_up", "gauge", "Whether nginx's traffic statistics could be read.")
+	if stats == nil {
+		writeSample(w, "router_nginx_up", nil, 0)
+		return
+	}
+	writeSample(w, "router_nginx_up", nil, 1)
+	writeHeader(w, "router_nginx_connections", "gauge", "Client connections to nginx, by state.")
+	writeSample(w, "router_nginx_connections", []string{"state", "active"}, stats.Connections.Active)
+	writeSample(w, "router_nginx_connections", []string{"state", "reading"}, stats.Connections.Reading)
+	writeSample(w, "router_nginx_connections", []string{"state", "writing"}, stats.Connections.Writing)
+	writeSample(w, "router_nginx_connections", []string{"state", "waiting"}, stats.Connections.Waiting)
+	writeHeader(w, "router_nginx_connections_total", "counter", "Client connections to nginx, by outcome.")
+	writeSample(w, "router_nginx_connections_total", []string{"outcome", "accepted"}, stats.Connections.Accepted)
+	writeSample(w, "router_nginx_connections_total", []string{"outcome", "handled"}, stats.Connections.Handled)
+
+	apps := stats.FilterZones[appFilterGroup]
+	appNames := make([]string, 0, len(apps))
+	for appName := range apps {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+	writeHeader(w, "router_app_requests_total", "counter", "Requests for each app.")
+	for _, appName := range appNames {
+		writeSample(w, "router_app_requests_total", []string{"app", appName}, apps[appName].RequestCounter)
+	}
+	writeHeader(w, "router_app_responses_total", "counter", "Responses from each app, by status class.")
+	for _, appName := range appNames {
+		for _, class := range responseClasses {
+			writeSample(w, "router_app_responses_total", []string{"app", appName, "code", class}, apps[appName].Responses[class])
+		}
+	}
+	writeHeader(w, "router_app_received_bytes_total", "counter", "Bytes received from clients of each app.")
+	for _, appName := range appNames {
+		writeSample(w, "router_app_received_bytes_total", []string{"app", appName}, apps[appName].InBytes)
+	}
+	writeHeader(w, "router_app_sent_bytes_total", "counter", "Bytes sent to clients of each app.")
+	for _, appName := range appNames {
+		writeSample(w, "router_app_sent_bytes_total", []string{"app", appName}, apps[appName].OutBytes)
+	}
+	writeHeader(w, "router_app_request_time_seconds", "gauge", "Average time taken to process recent requests for each app.")
+	for _, appName := range appNames {
+		writeSample(w, "router_app_request_time_seconds", []string{"app", appName}, apps[appName].RequestMsec/1000)
+	}
+}
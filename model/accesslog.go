@@ -0,0 +1,141 @@
+package model
+
+import (
+	"log"
+	"sort"
+)
+
+// knownLogFields are the nginx variables, named without their leading "$", that may be included
+// in structured access logs.  Each is defined for every request the router logs, regardless of
+// which optional features are enabled.
+var knownLogFields = map[string]bool{
+	"app_name":                 true,
+	"args":                     true,
+	"body_bytes_sent":          true,
+	"bytes_sent":               true,
+	"connection":               true,
+	"connection_requests":      true,
+	"host":                     true,
+	"http_host":                true,
+	"http_referer":             true,
+	"http_user_agent":          true,
+	"http_x_forwarded_for":     true,
+	"http_x_forwarded_proto":   true,
+	"msec":                     true,
+	"pipe":                     true,
+	"remote_addr":              true,
+	"remote_port":              true,
+	"remote_user":              true,
+	"request":                  true,
+	"request_id":               true,
+	"request_length":           true,
+	"request_method":           true,
+	"request_time":             true,
+	"request_uri":              true,
+	"scheme":                   true,
+	"server_name":              true,
+	"server_port":              true,
+	"server_protocol":          true,
+	"ssl_cipher":               true,
+	"ssl_protocol":             true,
+	"ssl_server_name":          true,
+	"ssl_session_reused":       true,
+	"status":                   true,
+	"time_iso8601":             true,
+	"time_local":               true,
+	"upstream_addr":            true,
+	"upstream_cache_status":    true,
+	"upstream_connect_time":    true,
+	"upstream_header_time":     true,
+	"upstream_response_length": true,
+	"upstream_response_time":   true,
+	"upstream_status":          true,
+	"uri":                      true,
+}
+
+// defaultLogFields are the fields of the "default" field set.  They match those of the default
+// text log format.
+var defaultLogFields = []string{
+	"time_iso8601",
+	"app_name",
+	"remote_addr",
+	"remote_user",
+	"status",
+	"request",
+	"bytes_sent",
+	"http_referer",
+	"http_user_agent",
+	"server_name",
+	"upstream_addr",
+	"http_host",
+	"upstream_response_time",
+	"request_time",
+}
+
+// extendedLogFields are the fields the "extended" field set adds to the default ones.
+var extendedLogFields = []string{
+	"request_id",
+	"request_length",
+	"scheme",
+	"ssl_protocol",
+	"ssl_cipher",
+	"ssl_server_name",
+	"upstream_status",
+	"upstream_connect_time",
+	"upstream_header_time",
+	"upstream_cache_status",
+	"connection",
+	"connection_requests",
+}
+
+// AccessLogConfig encapsulates configuration for the format of nginx's access log.
+type AccessLogConfig struct {
+	Format       string   `key:"format" constraint:"^(text|json)$"`
+	FieldSet     string   `key:"fieldSet" constraint:"^(default|extended|custom)$"`
+	CustomFields []string `key:"fields" constraint:"^[a-z0-9_]+(\\s*,\\s*[a-z0-9_]+)*$"`
+	Fields       []string
+}
+
+func newAccessLogConfig() *AccessLogConfig {
+	return &AccessLogConfig{
+		Format:   "text",
+		FieldSet: "default",
+	}
+}
+
+// buildLogFields returns the fields to include in structured access logs.  Custom fields that
+// aren't known nginx variables are skipped, and if none remain, the default fields are used.
+func buildLogFields(accessLogConfig *AccessLogConfig) []string {
+	switch accessLogConfig.FieldSet {
+	case "extended":
+		return append(append([]string{}, defaultLogFields...), extendedLogFields...)
+	case "custom":
+		fields := []string{}
+		seen := map[string]bool{}
+		for _, field := range accessLogConfig.CustomFields {
+			if !knownLogFields[field] {
+				log.Printf("WARN: Ignoring unknown access log field \"%s\"; known fields are: %v.\n", field, sortedLogFields())
+				continue
+			}
+			if seen[field] {
+				continue
+			}
+			seen[field] = true
+			fields = append(fields, field)
+		}
+		if len(fields) > 0 {
+			return fields
+		}
+		log.Printf("WARN: No valid custom access log fields were specified; using the default fields.\n")
+	}
+	return append([]string{}, defaultLogFields...)
+}
+
+func sortedLogFields() []string {
+	fields := make([]string, 0, len(knownLogFields))
+	for field := range knownLogFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
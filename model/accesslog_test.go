@@ -0,0 +1,40 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildLogFields(t *testing.T) {
+	accessLogConfig := newAccessLogConfig()
+	if fields := buildLogFields(accessLogConfig); !reflect.DeepEqual(fields, defaultLogFields) {
+		t.Errorf("Expected the default fields, but got %v", fields)
+	}
+
+	accessLogConfig.FieldSet = "extended"
+	fields := buildLogFields(accessLogConfig)
+	if len(fields) != len(defaultLogFields)+len(extendedLogFields) || fields[len(fields)-1] != "connection_requests" {
+		t.Errorf("Expected the default fields followed by the extended ones, but got %v", fields)
+	}
+
+	accessLogConfig.FieldSet = "custom"
+	accessLogConfig.CustomFields = []string{"status", "foo_bar", "request_time", "status"}
+	expected := []string{"status", "request_time"}
+	if fields := buildLogFields(accessLogConfig); !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected %v, but got %v", expected, fields)
+	}
+
+	// Without any valid custom fields, the default fields are used.
+	accessLogConfig.CustomFields = []string{"foo_bar"}
+	if fields := buildLogFields(accessLogConfig); !reflect.DeepEqual(fields, defaultLogFields) {
+		t.Errorf("Expected the default fields, but got %v", fields)
+	}
+}
+
+func TestLogFieldSetsAreKnown(t *testing.T) {
+	for _, field := range append(append([]string{}, defaultLogFields...), extendedLogFields...) {
+		if !knownLogFields[field] {
+			t.Errorf("Expected field %s to be known.", field)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"log"
+	"sort"
+	"strings"
+)
+
+// domainKey returns the name nginx will serve the given domain as, so that claims on the same
+// domain can be recognized however they are written.  Domains that aren't fully qualified are
+// served as subdomains of the platform domain, if there is one.
+func domainKey(routerConfig *RouterConfig, domain string) string {
+	domain = strings.ToLower(domain)
+	if !strings.Contains(domain, ".") && routerConfig.PlatformDomain != "" {
+		domain = domain + "." + strings.ToLower(routerConfig.PlatformDomain)
+	}
+	return domain
+}
+
+// resolveDomainConflicts ensures that each domain is routed to only one app.  Of the apps that
+// claim a domain, the one with the highest domain priority wins, then the one whose service or
+// Ingress was created first, and then, so that the outcome is always the same, the one whose
+// service or Ingress comes first by namespace and name.  The domain is dropped from the other
+// apps, and an app left without any domains is dropped altogether.
+func resolveDomainConflicts(routerConfig *RouterConfig) {
+	ranked := make([]*AppConfig, len(routerConfig.AppConfigs))
+	copy(ranked, routerConfig.AppConfigs)
+	sort.Stable(appConfigsByPrecedence(ranked))
+	owners := map[string]*AppConfig{}
+	for _, appConfig := range ranked {
+		domains := []string{}
+		for _, domain := range appConfig.Domains {
+			key := domainKey(routerConfig, domain)
+			owner, ok := owners[key]
+			if !ok {
+				owners[key] = appConfig
+				domains = append(domains, domain)
+				continue
+			}
+			if owner == appConfig {
+				// The app lists the domain more than once.
+				continue
+			}
+			log.Printf("WARN: Domain %s is claimed by both %s and %s; routing it to app %s only.\n", domain, describeObject(owner.Source), describeObject(appConfig.Source), owner.Name)
+			addProblem(routerConfig, appConfig.Source, ReasonDomainConflict, "Not routing domain %s to this app because %s, which takes precedence, also claims it.", domain, describeObject(owner.Source))
+			addProblem(routerConfig, owner.Source, ReasonDomainConflict, "Domain %s is also claimed by %s; it is routed to this app, which takes precedence.", domain, describeObject(appConfig.Source))
+			delete(appConfig.Certificates, domain)
+		}
+		appConfig.Domains = domains
+	}
+	appConfigs := []*AppConfig{}
+	for _, appConfig := range routerConfig.AppConfigs {
+		if len(appConfig.Domains) == 0 {
+			log.Printf("WARN: All of the domains of app %s are routed to other apps; not routing to it.\n", appConfig.Name)
+			continue
+		}
+		appConfigs = append(appConfigs, appConfig)
+	}
+	routerConfig.AppConfigs = appConfigs
+}
+
+// appConfigsByPrecedence sorts apps in the order in which their claims on domains are honored.
+type appConfigsByPrecedence []*AppConfig
+
+func (a appConfigsByPrecedence) Len() int      { return len(a) }
+func (a appConfigsByPrecedence) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a appConfigsByPrecedence) Less(i, j int) bool {
+	if a[i].DomainPriority != a[j].DomainPriority {
+		return a[i].DomainPriority > a[j].DomainPriority
+	}
+	if !a[i].Created.Equal(a[j].Created) {
+		return a[i].Created.Before(a[j].Created)
+	}
+	if a[i].Source.Namespace != a[j].Source.Namespace {
+		return a[i].Source.Namespace < a[j].Source.Namespace
+	}
+	return a[i].Source.Name < a[j].Source.Name
+}
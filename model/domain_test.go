@@ -0,0 +1,106 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/1.4/pkg/api/v1"
+)
+
+func newTestDomainAppConfig(namespace string, created time.Time, domains ...string) *AppConfig {
+	return &AppConfig{
+		Name:         namespace + "/" + namespace,
+		Source:       v1.ObjectReference{Kind: "Service", Namespace: namespace, Name: namespace},
+		Created:      created,
+		Domains:      domains,
+		Certificates: map[string]*Certificate{},
+	}
+}
+
+func TestResolveDomainConflicts(t *testing.T) {
+	older := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2016, 2, 1, 0, 0, 0, 0, time.UTC)
+	foo := newTestDomainAppConfig("foo", newer, "foo", "www.example.com")
+	foo.Certificates["www.example.com"] = &Certificate{}
+	bar := newTestDomainAppConfig("bar", older, "bar", "WWW.example.com")
+	// Bare domains are served as subdomains of the platform domain, so this claims foo's domain.
+	baz := newTestDomainAppConfig("baz", newer.Add(time.Hour), "foo.example.com")
+	routerConfig := &RouterConfig{PlatformDomain: "example.com", AppConfigs: []*AppConfig{foo, bar, baz}}
+
+	resolveDomainConflicts(routerConfig)
+	// The oldest app wins, but the newer foo still comes before baz, which is left without any
+	// domains and so is dropped.
+	if expected := []*AppConfig{foo, bar}; !reflect.DeepEqual(expected, routerConfig.AppConfigs) {
+		t.Errorf("Expected apps %v, but got %v", expected, routerConfig.AppConfigs)
+	}
+	if expected := []string{"foo"}; !reflect.DeepEqual(expected, foo.Domains) {
+		t.Errorf("Expected domains %v, but got %v", expected, foo.Domains)
+	}
+	if expected := []string{"bar", "WWW.example.com"}; !reflect.DeepEqual(expected, bar.Domains) {
+		t.Errorf("Expected domains %v, but got %v", expected, bar.Domains)
+	}
+	if _, ok := foo.Certificates["www.example.com"]; ok {
+		t.Error("Expected the certificate for a domain that was dropped to be removed")
+	}
+	// Each conflict is reported to both the loser and the winner.
+	if len(routerConfig.Problems) != 4 {
+		t.Errorf("Expected 4 problems, but got %v", routerConfig.Problems)
+	}
+	for _, problem := range routerConfig.Problems {
+		if problem.Reason != ReasonDomainConflict {
+			t.Errorf("Expected a domain conflict, but got %+v", problem)
+		}
+	}
+}
+
+func TestResolveDomainConflictsByPriority(t *testing.T) {
+	created := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	foo := newTestDomainAppConfig("foo", created.Add(time.Hour), "www.example.com", "foo.example.com")
+	foo.DomainPriority = 1
+	bar := newTestDomainAppConfig("bar", created, "www.example.com", "bar.example.com")
+	routerConfig := &RouterConfig{AppConfigs: []*AppConfig{foo, bar}}
+
+	// A higher priority beats being created first.
+	resolveDomainConflicts(routerConfig)
+	if expected := []string{"www.example.com", "foo.example.com"}; !reflect.DeepEqual(expected, foo.Domains) {
+		t.Errorf("Expected domains %v, but got %v", expected, foo.Domains)
+	}
+	if expected := []string{"bar.example.com"}; !reflect.DeepEqual(expected, bar.Domains) {
+		t.Errorf("Expected domains %v, but got %v", expected, bar.Domains)
+	}
+}
+
+func TestResolveDomainConflictsTieBreak(t *testing.T) {
+	created := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	foo := newTestDomainAppConfig("foo", created, "www.example.com", "foo.example.com")
+	bar := newTestDomainAppConfig("bar", created, "www.example.com", "bar.example.com")
+
+	// Apps of the same priority and age are ranked by namespace and name, whatever order they're
+	// listed in.
+	for _, appConfigs := range [][]*AppConfig{{foo, bar}, {bar, foo}} {
+		foo.Domains = []string{"www.example.com", "foo.example.com"}
+		bar.Domains = []string{"www.example.com", "bar.example.com"}
+		resolveDomainConflicts(&RouterConfig{AppConfigs: appConfigs})
+		if expected := []string{"foo.example.com"}; !reflect.DeepEqual(expected, foo.Domains) {
+			t.Errorf("Expected domains %v, but got %v", expected, foo.Domains)
+		}
+		if expected := []string{"www.example.com", "bar.example.com"}; !reflect.DeepEqual(expected, bar.Domains) {
+			t.Errorf("Expected domains %v, but got %v", expected, bar.Domains)
+		}
+	}
+}
+
+func TestDomainKey(t *testing.T) {
+	routerConfig := &RouterConfig{}
+	if key := domainKey(routerConfig, "Foo"); key != "foo" {
+		t.Errorf("Expected key foo, but got %s", key)
+	}
+	routerConfig.PlatformDomain = "Example.com"
+	if key := domainKey(routerConfig, "Foo"); key != "foo.example.com" {
+		t.Errorf("Expected key foo.example.com, but got %s", key)
+	}
+	if key := domainKey(routerConfig, "www.Example.org"); key != "www.example.org" {
+		t.Errorf("Expected key www.example.org, but got %s", key)
+	}
+}
@@ -0,0 +1,271 @@
+package model
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"k8s.io/client-go/1.4/kubernetes"
+	"k8s.io/client-go/1.4/pkg/api"
+	"k8s.io/client-go/1.4/pkg/api/errors"
+	"k8s.io/client-go/1.4/pkg/api/v1"
+	v1beta1ext "k8s.io/client-go/1.4/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/1.4/pkg/fields"
+	"k8s.io/client-go/1.4/pkg/labels"
+	"k8s.io/client-go/1.4/pkg/util/intstr"
+)
+
+// ingressClassAnnotation is the annotation by which an Ingress selects the controller that should
+// satisfy it.
+const ingressClassAnnotation = "kubernetes.io/ingress.class"
+
+// ingressPathRegex matches Ingress paths that can safely be used as nginx location prefixes.
+var ingressPathRegex = regexp.MustCompile(`^/[^\s;{}"'\\]*$`)
+
+// ingressHost is the routing an Ingress declares for a single host.
+type ingressHost struct {
+	host string
+	// backend serves any request not matched by one of paths.  It may be nil.
+	backend *v1beta1ext.IngressBackend
+	paths   []v1beta1ext.HTTPIngressPath
+}
+
+func getIngresses(kubeClient kubernetes.Interface, namespaces []string) (*v1beta1ext.IngressList, error) {
+	ingresses := &v1beta1ext.IngressList{}
+	for _, namespace := range namespaces {
+		ingressClient := kubeClient.Extensions().Ingresses(namespace)
+		namespaceIngresses, err := ingressClient.List(api.ListOptions{LabelSelector: labels.Everything(), FieldSelector: fields.Everything()})
+		if err != nil {
+			return nil, err
+		}
+		for _, ingress := range namespaceIngresses.Items {
+			if !containsString(excludedNamespaces, ingress.Namespace) {
+				ingresses.Items = append(ingresses.Items, ingress)
+			}
+		}
+	}
+	return ingresses, nil
+}
+
+// buildIngressHosts groups the given Ingress's rules by host.  A path of "/" (or no path at all)
+// takes the place of the Ingress's default backend for its host.
+func buildIngressHosts(ingress v1beta1ext.Ingress) []*ingressHost {
+	hosts := []*ingressHost{}
+	hostsByName := map[string]*ingressHost{}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.Host == "" {
+			log.Printf("WARN: Ignoring rule without a host in Ingress %s/%s.\n", ingress.Namespace, ingress.Name)
+			continue
+		}
+		host, ok := hostsByName[rule.Host]
+		if !ok {
+			host = &ingressHost{host: rule.Host, backend: ingress.Spec.Backend}
+			hostsByName[rule.Host] = host
+			hosts = append(hosts, host)
+		}
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if path.Path == "" || path.Path == "/" {
+				backend := path.Backend
+				host.backend = &backend
+				continue
+			}
+			if !ingressPathRegex.MatchString(path.Path) {
+				log.Printf("WARN: Ignoring invalid path \"%s\" in Ingress %s/%s.\n", path.Path, ingress.Namespace, ingress.Name)
+				continue
+			}
+			host.paths = append(host.paths, path)
+		}
+	}
+	return hosts
+}
+
+// buildIngressAppConfigs translates the given Ingress into one app per host.  Router options may
+// be set using the same annotations as on routable services, except for those that determine
+// domains and certificates, which come from the Ingress's own rules and TLS configuration.
+func buildIngressAppConfigs(kubeClient kubernetes.Interface, ingress v1beta1ext.Ingress, routerConfig *RouterConfig) ([]*AppConfig, error) {
+	certificates, err := buildIngressCertificates(kubeClient, ingress, routerConfig)
+	if err != nil {
+		return nil, err
+	}
+	appConfigs := []*AppConfig{}
+	for _, host := range buildIngressHosts(ingress) {
+		appConfig, err := newAppConfig(routerConfig)
+		if err != nil {
+			return nil, err
+		}
+		appConfig.Name = ingressAppName(ingress, host.host)
+		appConfig.Source = newObjectReference("Ingress", ingress.ObjectMeta)
+		appConfig.Created = ingress.CreationTimestamp.Time
+		err = mapAnnotations(routerConfig, "Ingress", ingress.ObjectMeta, "", appConfig)
+		if err != nil {
+			return nil, err
+		}
+		appConfig.Domains = []string{host.host}
+		appConfig.CertMappings = nil
+		// A back end TLS server name set explicitly applies to all of the Ingress's back ends, but
+		// the default depends on the service each path routes to.
+		serverName := appConfig.BackendTLSConfig.ServerName
+		serviceName := ""
+		if host.backend != nil {
+			serviceName = host.backend.ServiceName
+		}
+		err = completeAppConfig(kubeClient, appConfig, routerConfig, ingress.Namespace, serviceName)
+		if err != nil {
+			return nil, err
+		}
+		if certificate, ok := certificates[host.host]; ok {
+			appConfig.Certificates[host.host] = certificate
+		} else if certificate, ok := certificates[""]; ok {
+			appConfig.Certificates[host.host] = certificate
+		}
+		if host.backend != nil {
+			serviceIP, port, available, err := resolveIngressBackend(kubeClient, ingress.Namespace, *host.backend)
+			if err != nil {
+				return nil, err
+			}
+			appConfig.ServiceIP = serviceIP
+			appConfig.BackendPort = port
+			appConfig.Available = available
+			if available {
+				appConfig.UpstreamServers = buildUpstreamServers(appConfig)
+			} else {
+				addProblem(routerConfig, appConfig.Source, ReasonEndpointsUnavailable, "Back end %s/%s:%s for %s is unavailable; requests for it will fail.", ingress.Namespace, host.backend.ServiceName, ingressServicePortString(host.backend.ServicePort), host.host)
+			}
+		}
+		for _, path := range host.paths {
+			location := findLocation(appConfig, path.Path)
+			if location == nil {
+				location = newLocation(path.Path, nil)
+				appConfig.Locations = append(appConfig.Locations, location)
+			}
+			serviceIP, port, available, err := resolveIngressBackend(kubeClient, ingress.Namespace, path.Backend)
+			if err != nil {
+				return nil, err
+			}
+			location.Backend = fmt.Sprintf("%s/%s:%s", ingress.Namespace, path.Backend.ServiceName, ingressServicePortString(path.Backend.ServicePort))
+			location.ServerName = serverName
+			if location.ServerName == "" {
+				location.ServerName = serviceDNSName(path.Backend.ServiceName, ingress.Namespace)
+			}
+			location.Available = available
+			if available {
+				location.UpstreamServers = buildServiceUpstreamServers(appConfig, serviceIP, port)
+			} else {
+				addProblem(routerConfig, appConfig.Source, ReasonEndpointsUnavailable, "Back end %s for %s%s is unavailable; requests for it will fail.", location.Backend, host.host, path.Path)
+			}
+		}
+		appConfigs = append(appConfigs, appConfig)
+	}
+	return appConfigs, nil
+}
+
+// ingressAppName returns the name under which the given host of the given Ingress is known to the
+// router.  App names key cache purging, metrics, and the directories holding error pages and back
+// end certs, so they must not collide with those of routable services or of the Ingress's other
+// hosts.  The prefix can't begin a namespace, so names like appName's can't take this form.
+func ingressAppName(ingress v1beta1ext.Ingress, host string) string {
+	return fmt.Sprintf("ingress:%s/%s/%s", ingress.Namespace, ingress.Name, host)
+}
+
+// buildIngressCertificates returns the certificates named by the given Ingress's TLS
+// configuration, keyed by host.  A certificate that doesn't list any hosts is keyed by "" and
+// applies to all of the Ingress's hosts.
+func buildIngressCertificates(kubeClient kubernetes.Interface, ingress v1beta1ext.Ingress, routerConfig *RouterConfig) (map[string]*Certificate, error) {
+	certificates := map[string]*Certificate{}
+	for _, tls := range ingress.Spec.TLS {
+		if tls.SecretName == "" {
+			continue
+		}
+		certSecret, err := getSecret(kubeClient, tls.SecretName, ingress.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		if certSecret == nil {
+			log.Printf("WARN: The k8s secret %s named by Ingress %s/%s was not found.\n", tls.SecretName, ingress.Namespace, ingress.Name)
+			addProblem(routerConfig, newObjectReference("Ingress", ingress.ObjectMeta), ReasonSecretNotFound, "The secret %s holding the certificate for %s was not found.", tls.SecretName, ingressTLSHosts(tls))
+			continue
+		}
+		certificate, err := buildCertificate(certSecret, fmt.Sprintf("Ingress %s/%s", ingress.Namespace, ingress.Name))
+		if err != nil {
+			return nil, err
+		}
+		if len(tls.Hosts) == 0 {
+			certificates[""] = certificate
+		}
+		for _, host := range tls.Hosts {
+			certificates[host] = certificate
+		}
+	}
+	return certificates, nil
+}
+
+// resolveIngressBackend returns the cluster IP and port of the service referred to by the given
+// Ingress backend, and whether it has any endpoints.  A backend that can't be resolved is
+// reported as unavailable rather than as an error, so one broken Ingress can't take down others.
+func resolveIngressBackend(kubeClient kubernetes.Interface, namespace string, backend v1beta1ext.IngressBackend) (string, int, bool, error) {
+	service, err := kubeClient.Core().Services(namespace).Get(backend.ServiceName)
+	if err != nil {
+		statusErr, ok := err.(*errors.StatusError)
+		if ok && statusErr.Status().Code == 404 {
+			log.Printf("WARN: The service %s/%s referred to by an Ingress was not found.\n", namespace, backend.ServiceName)
+			return "", 0, false, nil
+		}
+		return "", 0, false, err
+	}
+	if service.Spec.ClusterIP == "" || service.Spec.ClusterIP == v1.ClusterIPNone {
+		log.Printf("WARN: The service %s/%s referred to by an Ingress has no cluster IP.\n", namespace, backend.ServiceName)
+		return "", 0, false, nil
+	}
+	port := findServicePort(service, backend.ServicePort)
+	if port == 0 {
+		log.Printf("WARN: The service %s/%s referred to by an Ingress has no port %s.\n", namespace, backend.ServiceName, ingressServicePortString(backend.ServicePort))
+		return "", 0, false, nil
+	}
+	available, err := isServiceAvailable(kubeClient, namespace, backend.ServiceName)
+	if err != nil {
+		return "", 0, false, err
+	}
+	return service.Spec.ClusterIP, port, available, nil
+}
+
+// findServicePort returns the number of the given service's port that an Ingress backend's port,
+// given by number or by name, refers to, or 0 if there is no such port.
+func findServicePort(service *v1.Service, servicePort intstr.IntOrString) int {
+	for _, port := range service.Spec.Ports {
+		if servicePort.Type == intstr.Int && port.Port == servicePort.IntVal {
+			return int(port.Port)
+		}
+		if servicePort.Type == intstr.String && port.Name == servicePort.StrVal {
+			return int(port.Port)
+		}
+	}
+	return 0
+}
+
+// ingressTLSHosts describes the hosts to which the given Ingress TLS configuration applies.
+func ingressTLSHosts(tls v1beta1ext.IngressTLS) string {
+	if len(tls.Hosts) == 0 {
+		return "all hosts"
+	}
+	return strings.Join(tls.Hosts, ", ")
+}
+
+func ingressServicePortString(servicePort intstr.IntOrString) string {
+	if servicePort.Type == intstr.Int {
+		return fmt.Sprintf("%d", servicePort.IntVal)
+	}
+	return servicePort.StrVal
+}
+
+func findLocation(appConfig *AppConfig, path string) *Location {
+	for _, location := range appConfig.Locations {
+		if location.Path == path {
+			return location
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/1.4/kubernetes/fake"
+	"k8s.io/client-go/1.4/pkg/api/v1"
+	v1beta1ext "k8s.io/client-go/1.4/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/1.4/pkg/util/intstr"
+)
+
+func newTestIngressBackend(serviceName string, port int) v1beta1ext.IngressBackend {
+	return v1beta1ext.IngressBackend{ServiceName: serviceName, ServicePort: intstr.FromInt(port)}
+}
+
+func TestBuildIngressHosts(t *testing.T) {
+	defaultBackend := newTestIngressBackend("default", 80)
+	ingress := v1beta1ext.Ingress{
+		ObjectMeta: v1.ObjectMeta{Name: "shop", Namespace: "foo"},
+		Spec: v1beta1ext.IngressSpec{
+			Backend: &defaultBackend,
+			Rules: []v1beta1ext.IngressRule{
+				{
+					Host: "shop.example.com",
+					IngressRuleValue: v1beta1ext.IngressRuleValue{
+						HTTP: &v1beta1ext.HTTPIngressRuleValue{
+							Paths: []v1beta1ext.HTTPIngressPath{
+								{Path: "/", Backend: newTestIngressBackend("web", 80)},
+								{Path: "/api", Backend: newTestIngressBackend("api", 8080)},
+								{Path: "/bad path", Backend: newTestIngressBackend("api", 8080)},
+							},
+						},
+					},
+				},
+				// Rules without a host are ignored.
+				{
+					IngressRuleValue: v1beta1ext.IngressRuleValue{
+						HTTP: &v1beta1ext.HTTPIngressRuleValue{
+							Paths: []v1beta1ext.HTTPIngressPath{{Backend: newTestIngressBackend("web", 80)}},
+						},
+					},
+				},
+				// Hosts without their own root path fall back to the default backend.
+				{Host: "status.example.com"},
+				// Rules for the same host are merged.
+				{
+					Host: "shop.example.com",
+					IngressRuleValue: v1beta1ext.IngressRuleValue{
+						HTTP: &v1beta1ext.HTTPIngressRuleValue{
+							Paths: []v1beta1ext.HTTPIngressPath{{Path: "/cart", Backend: newTestIngressBackend("cart", 80)}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	webBackend := newTestIngressBackend("web", 80)
+	expectedHosts := []*ingressHost{
+		{
+			host:    "shop.example.com",
+			backend: &webBackend,
+			paths: []v1beta1ext.HTTPIngressPath{
+				{Path: "/api", Backend: newTestIngressBackend("api", 8080)},
+				{Path: "/cart", Backend: newTestIngressBackend("cart", 80)},
+			},
+		},
+		{
+			host:    "status.example.com",
+			backend: &defaultBackend,
+		},
+	}
+	actualHosts := buildIngressHosts(ingress)
+	if !reflect.DeepEqual(expectedHosts, actualHosts) {
+		t.Errorf("Expected hosts %+v, but got %+v", expectedHosts, actualHosts)
+	}
+}
+
+func TestFindServicePort(t *testing.T) {
+	service := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{Name: "http", Port: 80},
+				{Name: "grpc", Port: 9000},
+			},
+		},
+	}
+	testCases := []struct {
+		servicePort  intstr.IntOrString
+		expectedPort int
+	}{
+		{intstr.FromInt(80), 80},
+		{intstr.FromInt(9000), 9000},
+		{intstr.FromString("grpc"), 9000},
+		{intstr.FromInt(8080), 0},
+		{intstr.FromString("https"), 0},
+	}
+	for _, testCase := range testCases {
+		if actualPort := findServicePort(service, testCase.servicePort); actualPort != testCase.expectedPort {
+			t.Errorf("Expected port %d for %s, but got %d", testCase.expectedPort, ingressServicePortString(testCase.servicePort), actualPort)
+		}
+	}
+}
+
+func TestBuildIngressAppConfigsBackendTLS(t *testing.T) {
+	newService := func(name string, clusterIP string) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "foo"},
+			Spec:       v1.ServiceSpec{ClusterIP: clusterIP, Ports: []v1.ServicePort{{Port: 443}}},
+		}
+	}
+	kubeClient := fake.NewSimpleClientset(newService("api", "10.0.0.1"), newService("cart", "10.0.0.2"))
+	ingress := v1beta1ext.Ingress{
+		ObjectMeta: v1.ObjectMeta{Name: "shop", Namespace: "foo", Annotations: map[string]string{"router.deis.io/backendProtocol": "https"}},
+		Spec: v1beta1ext.IngressSpec{
+			Rules: []v1beta1ext.IngressRule{
+				{
+					Host: "shop.example.com",
+					IngressRuleValue: v1beta1ext.IngressRuleValue{
+						HTTP: &v1beta1ext.HTTPIngressRuleValue{
+							Paths: []v1beta1ext.HTTPIngressPath{
+								{Path: "/api", Backend: newTestIngressBackend("api", 443)},
+								{Path: "/cart", Backend: newTestIngressBackend("cart", 443)},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	routerConfig, err := newRouterConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appConfigs, err := buildIngressAppConfigs(kubeClient, ingress, routerConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(appConfigs) != 1 {
+		t.Fatalf("Expected 1 app, but got %d", len(appConfigs))
+	}
+	// The app is named for the Ingress and host, so it can't collide with a service named "shop".
+	if name := appConfigs[0].Name; name != "ingress:foo/shop/shop.example.com" {
+		t.Errorf("Expected app ingress:foo/shop/shop.example.com, but got %s", name)
+	}
+	// Without a default back end, there's no service to derive the app's server name from.
+	if serverName := appConfigs[0].BackendTLSConfig.ServerName; serverName != "" {
+		t.Errorf("Expected no server name for the app, but got %s", serverName)
+	}
+	// Each path expects the name of the service it routes to.
+	expected := map[string]string{"/api": "api.foo.svc.cluster.local", "/cart": "cart.foo.svc.cluster.local"}
+	for _, location := range appConfigs[0].Locations {
+		if serverName, ok := expected[location.Path]; ok && location.ServerName != serverName {
+			t.Errorf("Expected server name %s for %s, but got %s", serverName, location.Path, location.ServerName)
+		}
+	}
+
+	// A server name set explicitly applies to every path.
+	ingress.Annotations["router.deis.io/backendTLS.serverName"] = "shop.internal"
+	appConfigs, err = buildIngressAppConfigs(kubeClient, ingress, routerConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, location := range appConfigs[0].Locations {
+		if location.Backend != "" && location.ServerName != "shop.internal" {
+			t.Errorf("Expected server name shop.internal for %s, but got %s", location.Path, location.ServerName)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package model
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxMaintenanceWindowDuration is the longest recurring maintenance window the router will honor.
+const maxMaintenanceWindowDuration = 7 * 24 * time.Hour
+
+// now returns the current time.  It is a variable so that tests may substitute a fixed time.
+var now = time.Now
+
+// MaintenanceConfig represents configuration options having to do with scheduled maintenance.
+// A one-time window runs from Start to End (either of which may be omitted).  A recurring window
+// begins whenever the cron-like Schedule matches, evaluated in UTC, and lasts for Duration.
+type MaintenanceConfig struct {
+	Start           string   `key:"start" constraint:"^[0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}:[0-9]{2}:[0-9]{2}(\\.[0-9]+)?(Z|[+-][0-9]{2}:[0-9]{2})$"`
+	End             string   `key:"end" constraint:"^[0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}:[0-9]{2}:[0-9]{2}(\\.[0-9]+)?(Z|[+-][0-9]{2}:[0-9]{2})$"`
+	Schedule        string   `key:"schedule" constraint:"^[0-9*,/-]+(\\s+[0-9*,/-]+){4}$"`
+	Duration        string   `key:"duration" constraint:"^([0-9]+(h|m))+$"`
+	BypassWhitelist []string `key:"bypassWhitelist" constraint:"^((([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])\\.){3}([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])(\\/([0-9]|[1-2][0-9]|3[0-2]))?(\\s*,\\s*)?)+$"`
+}
+
+func newMaintenanceConfig() *MaintenanceConfig {
+	return &MaintenanceConfig{}
+}
+
+// inMaintenanceWindow returns whether the given time falls within a one-time or recurring
+// maintenance window described by the given configuration.  Windows that cannot be parsed are
+// ignored with a warning.
+func inMaintenanceWindow(maintenanceConfig *MaintenanceConfig, t time.Time, context string) bool {
+	if maintenanceConfig.Start != "" || maintenanceConfig.End != "" {
+		start, end, err := parseMaintenanceWindow(maintenanceConfig.Start, maintenanceConfig.End)
+		if err != nil {
+			log.Printf("WARN: Ignoring invalid maintenance window for %s: %v\n", context, err)
+		} else if (start.IsZero() || !t.Before(start)) && (end.IsZero() || t.Before(end)) {
+			return true
+		}
+	}
+	if maintenanceConfig.Schedule != "" || maintenanceConfig.Duration != "" {
+		schedule, duration, err := parseRecurringMaintenanceWindow(maintenanceConfig.Schedule, maintenanceConfig.Duration)
+		if err != nil {
+			log.Printf("WARN: Ignoring invalid recurring maintenance window for %s: %v\n", context, err)
+		} else if schedule.activeWithin(t, duration) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseMaintenanceWindow(startStr string, endStr string) (time.Time, time.Time, error) {
+	var start, end time.Time
+	var err error
+	if startStr != "" {
+		if start, err = time.Parse(time.RFC3339, startStr); err != nil {
+			return start, end, err
+		}
+	}
+	if endStr != "" {
+		if end, err = time.Parse(time.RFC3339, endStr); err != nil {
+			return start, end, err
+		}
+	}
+	if !start.IsZero() && !end.IsZero() && !end.After(start) {
+		return start, end, fmt.Errorf("end %s is not after start %s", endStr, startStr)
+	}
+	return start, end, nil
+}
+
+func parseRecurringMaintenanceWindow(scheduleStr string, durationStr string) (*cronSchedule, time.Duration, error) {
+	if scheduleStr == "" || durationStr == "" {
+		return nil, 0, fmt.Errorf("both a schedule and a duration are required")
+	}
+	schedule, err := parseCronSchedule(scheduleStr)
+	if err != nil {
+		return nil, 0, err
+	}
+	duration, err := time.ParseDuration(durationStr)
+	if err != nil {
+		return nil, 0, err
+	}
+	if duration <= 0 || duration > maxMaintenanceWindowDuration {
+		return nil, 0, fmt.Errorf("duration %s is not between 1m and %s", durationStr, maxMaintenanceWindowDuration)
+	}
+	return schedule, duration, nil
+}
+
+// cronSchedule is a parsed, cron-like schedule of the form
+// "<minute> <hour> <day of month> <month> <day of week>".  Each field may be "*", a value, a
+// range ("1-5"), a step ("*/15" or "0-30/10"), or a comma-delimited list of those.
+type cronSchedule struct {
+	minutes     map[int]bool
+	hours       map[int]bool
+	daysOfMonth map[int]bool
+	months      map[int]bool
+	daysOfWeek  map[int]bool
+	// As in cron, when both day of month and day of week are restricted, a time matching either
+	// one matches the schedule.
+	restrictedDays bool
+}
+
+func parseCronSchedule(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q does not have exactly five fields", spec)
+	}
+	bounds := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	values := make([]map[int]bool, len(fields))
+	for i, field := range fields {
+		fieldValues, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %v", spec, err)
+		}
+		values[i] = fieldValues
+	}
+	// Both 0 and 7 mean Sunday.
+	if values[4][7] {
+		values[4][0] = true
+	}
+	return &cronSchedule{
+		minutes:        values[0],
+		hours:          values[1],
+		daysOfMonth:    values[2],
+		months:         values[3],
+		daysOfWeek:     values[4],
+		restrictedDays: fields[2] != "*" && fields[4] != "*",
+	}, nil
+}
+
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		rangeStr, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangeStr = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+		low, high := min, max
+		if rangeStr != "*" {
+			bounds := strings.SplitN(rangeStr, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value in %q", part)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid range in %q", part)
+				}
+			} else if step > 1 {
+				// As in cron, "5/15" means "5-<max>/15".
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for value := low; value <= high; value += step {
+			values[value] = true
+		}
+	}
+	return values, nil
+}
+
+// matches returns whether the schedule matches the minute containing the given time.
+func (c *cronSchedule) matches(t time.Time) bool {
+	t = t.UTC()
+	if !c.minutes[t.Minute()] || !c.hours[t.Hour()] || !c.months[int(t.Month())] {
+		return false
+	}
+	if c.restrictedDays {
+		return c.daysOfMonth[t.Day()] || c.daysOfWeek[int(t.Weekday())]
+	}
+	return c.daysOfMonth[t.Day()] && c.daysOfWeek[int(t.Weekday())]
+}
+
+// activeWithin returns whether the schedule matched at any minute within the given duration
+// preceding (and including) the given time.
+func (c *cronSchedule) activeWithin(t time.Time, duration time.Duration) bool {
+	earliest := t.Add(-duration)
+	for start := t.UTC().Truncate(time.Minute); start.After(earliest); start = start.Add(-time.Minute) {
+		if c.matches(start) {
+			return true
+		}
+	}
+	return false
+}
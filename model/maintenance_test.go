@@ -0,0 +1,70 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInMaintenanceWindow(t *testing.T) {
+	testCases := []struct {
+		maintenanceConfig *MaintenanceConfig
+		now               string
+		expected          bool
+	}{
+		// No windows at all
+		{&MaintenanceConfig{}, "2017-01-01T03:00:00Z", false},
+		// One-time windows
+		{&MaintenanceConfig{Start: "2017-01-01T02:00:00Z", End: "2017-01-01T04:00:00Z"}, "2017-01-01T01:59:59Z", false},
+		{&MaintenanceConfig{Start: "2017-01-01T02:00:00Z", End: "2017-01-01T04:00:00Z"}, "2017-01-01T02:00:00Z", true},
+		{&MaintenanceConfig{Start: "2017-01-01T02:00:00Z", End: "2017-01-01T04:00:00Z"}, "2017-01-01T04:00:00Z", false},
+		{&MaintenanceConfig{Start: "2017-01-01T02:00:00-05:00", End: "2017-01-01T04:00:00-05:00"}, "2017-01-01T08:00:00Z", true},
+		{&MaintenanceConfig{Start: "2017-01-01T02:00:00Z"}, "2018-01-01T00:00:00Z", true},
+		{&MaintenanceConfig{End: "2017-01-01T04:00:00Z"}, "2017-01-01T03:00:00Z", true},
+		// An end before the start is ignored
+		{&MaintenanceConfig{Start: "2017-01-01T04:00:00Z", End: "2017-01-01T02:00:00Z"}, "2017-01-01T03:00:00Z", false},
+		// Recurring windows: daily at 02:00 UTC for two hours
+		{&MaintenanceConfig{Schedule: "0 2 * * *", Duration: "2h"}, "2017-01-01T01:59:00Z", false},
+		{&MaintenanceConfig{Schedule: "0 2 * * *", Duration: "2h"}, "2017-01-01T02:00:00Z", true},
+		{&MaintenanceConfig{Schedule: "0 2 * * *", Duration: "2h"}, "2017-01-01T03:59:59Z", true},
+		{&MaintenanceConfig{Schedule: "0 2 * * *", Duration: "2h"}, "2017-01-01T04:00:00Z", false},
+		// Recurring windows spanning midnight: Sundays at 23:30 UTC for one hour (2017-01-01 is a Sunday)
+		{&MaintenanceConfig{Schedule: "30 23 * * 0", Duration: "1h"}, "2017-01-02T00:15:00Z", true},
+		{&MaintenanceConfig{Schedule: "30 23 * * 7", Duration: "1h"}, "2017-01-02T00:15:00Z", true},
+		{&MaintenanceConfig{Schedule: "30 23 * * 1", Duration: "1h"}, "2017-01-02T00:15:00Z", false},
+		// A recurring window without a duration is ignored
+		{&MaintenanceConfig{Schedule: "0 2 * * *"}, "2017-01-01T02:30:00Z", false},
+	}
+	for _, testCase := range testCases {
+		now, err := time.Parse(time.RFC3339, testCase.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual := inMaintenanceWindow(testCase.maintenanceConfig, now, "foo")
+		if actual != testCase.expected {
+			t.Errorf("Expected %+v at %s to be in maintenance: %t, but got %t", testCase.maintenanceConfig, testCase.now, testCase.expected, actual)
+		}
+	}
+}
+
+func TestParseCronSchedule(t *testing.T) {
+	schedule, err := parseCronSchedule("*/15 0-5 1,15 * 1-5/2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, minute := range []int{0, 15, 30, 45} {
+		if !schedule.minutes[minute] {
+			t.Errorf("Expected minute %d to be scheduled", minute)
+		}
+	}
+	if len(schedule.minutes) != 4 || len(schedule.hours) != 6 || len(schedule.daysOfMonth) != 2 || len(schedule.months) != 12 {
+		t.Errorf("Unexpected schedule %+v", schedule)
+	}
+	if !schedule.daysOfWeek[1] || schedule.daysOfWeek[2] || !schedule.daysOfWeek[3] || !schedule.daysOfWeek[5] {
+		t.Errorf("Expected days of week 1, 3, and 5 to be scheduled, but got %v", schedule.daysOfWeek)
+	}
+	for _, spec := range []string{"0 2 * *", "60 2 * * *", "0 24 * * *", "0 2 0 * *", "0 2 * 13 *", "0 2 * * 8", "0 5-2 * * *", "*/0 2 * * *"} {
+		if _, err := parseCronSchedule(spec); err == nil {
+			t.Errorf("Expected schedule %q to be rejected", spec)
+		}
+	}
+}
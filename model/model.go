@@ -3,9 +3,15 @@ package model
 import (
 	"bytes"
 	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/deis/router/utils"
 	modelerUtility "github.com/deis/router/utils/modeler"
@@ -26,14 +32,61 @@ const (
 )
 
 var (
-	namespace   = utils.GetOpt("POD_NAMESPACE", "default")
-	modeler     = modelerUtility.NewModeler(prefix, modelerFieldTag, modelerConstraintTag, true)
-	listOptions api.ListOptions
+	namespace              = utils.GetOpt("POD_NAMESPACE", "default")
+	deploymentName         = utils.GetOpt("DEPLOYMENT_NAME", "deis-router")
+	routableSelector       = utils.GetOpt("ROUTABLE_SELECTOR", fmt.Sprintf("%s/routable=true", prefix))
+	platformCertSecretName = utils.GetOpt("PLATFORM_CERT_SECRET", "deis-router-platform-cert")
+	dhParamSecretName      = utils.GetOpt("DHPARAM_SECRET", "deis-router-dhparam")
+	routerClass            = utils.GetOpt("ROUTER_CLASS", "")
+	allowedNamespaces      = splitList(utils.GetOpt("NAMESPACES", ""))
+	excludedNamespaces     = splitList(utils.GetOpt("EXCLUDED_NAMESPACES", ""))
+	namespaceSelector      = utils.GetOpt("NAMESPACE_SELECTOR", "")
+	modeler                = modelerUtility.NewModeler(prefix, modelerFieldTag, modelerConstraintTag, true)
+	listOptions            api.ListOptions
+	namespaceListOptions   *api.ListOptions
 )
 
+// routerClassAnnotation assigns a routable service to the router instances of the same class.
+// Services without it are assigned to router instances without a class.
+var routerClassAnnotation = fmt.Sprintf("%s/class", prefix)
+
+// routerManagedRequestHeaders are the (canonicalized) names of request headers that the router
+// sets on every proxied request.
+var routerManagedRequestHeaders = map[string]bool{
+	"Host":              true,
+	"X-Forwarded-For":   true,
+	"X-Forwarded-Proto": true,
+	"X-Forwarded-Port":  true,
+	"Upgrade":           true,
+	"Connection":        true,
+	"X-Request-Id":      true,
+	"X-Correlation-Id":  true,
+}
+
+// errorPageNames are the names of the custom pages an app may provide: the maintenance page and a
+// page for each supported error code.
+var errorPageNames = []string{"maintenance", "404", "502", "503", "504"}
+
 func init() {
-	labelMap := labels.Set{fmt.Sprintf("%s/routable", prefix): "true"}
-	listOptions = api.ListOptions{LabelSelector: labelMap.AsSelector(), FieldSelector: fields.Everything()}
+	selector, err := labels.Parse(routableSelector)
+	if err != nil {
+		log.Fatalf("Invalid routable service selector \"%s\": %v", routableSelector, err)
+	}
+	listOptions = api.ListOptions{LabelSelector: selector, FieldSelector: fields.Everything()}
+	if namespaceSelector != "" {
+		selector, err := labels.Parse(namespaceSelector)
+		if err != nil {
+			log.Fatalf("Invalid namespace selector \"%s\": %v", namespaceSelector, err)
+		}
+		namespaceListOptions = &api.ListOptions{LabelSelector: selector, FieldSelector: fields.Everything()}
+	}
+}
+
+// SetStrictValidation determines whether annotation values that don't satisfy their constraints
+// fail the build or are merely skipped, with a warning, in favor of default values.  The latter
+// keeps one misconfigured app from affecting the others, and is the default.
+func SetStrictValidation(strict bool) {
+	modeler = modelerUtility.NewModeler(prefix, modelerFieldTag, modelerConstraintTag, !strict)
 }
 
 // RouterConfig is the primary type used to encapsulate all router configuration.
@@ -54,6 +107,7 @@ type RouterConfig struct {
 	EnforceWhitelists        bool        `key:"enforceWhitelists" constraint:"(?i)^(true|false)$"`
 	DefaultWhitelist         []string    `key:"defaultWhitelist" constraint:"^((([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])\\.){3}([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])(\\/([0-9]|[1-2][0-9]|3[0-2]))?(\\s*,\\s*)?)+$"`
 	WhitelistMode            string      `key:"whitelistMode" constraint:"^(extend|override)$"`
+	DefaultBlacklist         []string    `key:"defaultBlacklist" constraint:"^((([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])\\.){3}([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])(\\/([0-9]|[1-2][0-9]|3[0-2]))?(\\s*,\\s*)?)+$"`
 	DefaultServiceIP         string      `key:"defaultServiceIP"`
 	DefaultAppName           string      `key:"defaultAppName"`
 	DefaultServiceEnabled    bool        `key:"defaultServiceEnabled" constraint:"(?i)^(true|false)$"`
@@ -61,10 +115,21 @@ type RouterConfig struct {
 	SSLConfig                *SSLConfig  `key:"ssl"`
 	AppConfigs               []*AppConfig
 	BuilderConfig            *BuilderConfig
+	StreamConfigs            []*StreamConfig
+	PassthroughConfigs       []*PassthroughConfig
 	PlatformCertificate      *Certificate
-	HTTP2Enabled             bool                `key:"http2Enabled" constraint:"(?i)^(true|false)$"`
-	LogFormat                string              `key:"logFormat"`
-	ProxyBuffersConfig       *ProxyBuffersConfig `key:"proxyBuffers"`
+	HTTP2Enabled             bool                 `key:"http2Enabled" constraint:"(?i)^(true|false)$"`
+	LogFormat                string               `key:"logFormat" constraint:"^[^'\\\\]+$"`
+	AccessLogConfig          *AccessLogConfig     `key:"accessLog"`
+	LogForwardingConfig      *LogForwardingConfig `key:"logForwarding"`
+	ProxyBuffersConfig       *ProxyBuffersConfig  `key:"proxyBuffers"`
+	GeoIPConfig              *GeoIPConfig         `key:"geoip"`
+	HeadersConfig            *HeadersConfig       `key:"headers"`
+	CacheZones               []string             `key:"cacheZones" constraint:"^[a-z0-9_]+\\s+/[^\\s,;\"]+\\s+[1-9]\\d*[kKmMgG]?\\s+[1-9]\\d*(ms|[smhdwMy])?(\\s*,\\s*[a-z0-9_]+\\s+/[^\\s,;\"]+\\s+[1-9]\\d*[kKmMgG]?\\s+[1-9]\\d*(ms|[smhdwMy])?)*$"`
+	CacheZoneConfigs         []*CacheZone
+	IngressClass             string `key:"ingressClass" constraint:"^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$"`
+	RejectedAnnotations      []*RejectedAnnotation
+	Problems                 []*Problem
 }
 
 func newRouterConfig() (*RouterConfig, error) {
@@ -94,7 +159,12 @@ func newRouterConfig() (*RouterConfig, error) {
 		DefaultServiceIP:         "",
 		HTTP2Enabled:             true,
 		LogFormat:                `[$time_iso8601] - $app_name - $remote_addr - $remote_user - $status - "$request" - $bytes_sent - "$http_referer" - "$http_user_agent" - "$server_name" - $upstream_addr - $http_host - $upstream_response_time - $request_time`,
+		AccessLogConfig:          newAccessLogConfig(),
+		LogForwardingConfig:      newLogForwardingConfig(),
 		ProxyBuffersConfig:       proxyBuffersConfig,
+		GeoIPConfig:              newGeoIPConfig(),
+		HeadersConfig:            newHeadersConfig(),
+		IngressClass:             "deis",
 	}, nil
 }
 
@@ -123,20 +193,74 @@ func newGzipConfig() *GzipConfig {
 	}
 }
 
+// GeoIPConfig encapsulates configuration for resolving client addresses to countries.
+type GeoIPConfig struct {
+	Enabled         bool   `key:"enabled" constraint:"(?i)^(true|false)$"`
+	CountryDatabase string `key:"countryDatabase" constraint:"^/[^\\s;]+$"`
+}
+
+func newGeoIPConfig() *GeoIPConfig {
+	return &GeoIPConfig{
+		Enabled:         false,
+		CountryDatabase: "/opt/router/geoip/GeoIP.dat",
+	}
+}
+
+// LogForwardingConfig encapsulates configuration for forwarding nginx's access and error logs.
+type LogForwardingConfig struct {
+	Sinks         []string `key:"sinks" constraint:"^(stdout|syslog|http)(\\s*,\\s*(stdout|syslog|http))*$"`
+	SyslogAddress string   `key:"syslogAddress" constraint:"^(tcp|udp)://[^\\s/]+:[1-9]\\d*$"`
+	HTTPURL       string   `key:"httpURL" constraint:"^https?://[^\\s]+$"`
+	BufferSize    int      `key:"bufferSize" constraint:"^[1-9]\\d*$"`
+	DropPolicy    string   `key:"dropPolicy" constraint:"^(newest|oldest)$"`
+}
+
+func newLogForwardingConfig() *LogForwardingConfig {
+	return &LogForwardingConfig{
+		Sinks:      []string{"stdout"},
+		BufferSize: 10000,
+		DropPolicy: "newest",
+	}
+}
+
 // AppConfig encapsulates the configuration for all routes to a single back end.
 type AppConfig struct {
-	Name           string
-	Domains        []string `key:"domains" constraint:"(?i)^((([a-z0-9]+(-*[a-z0-9]+)*)|((\\*\\.)?[a-z0-9]+(-*[a-z0-9]+)*\\.)+[a-z0-9]+(-*[a-z0-9]+)+)(\\s*,\\s*)?)+$"`
-	Whitelist      []string `key:"whitelist" constraint:"^((([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])\\.){3}([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])(\\/([0-9]|[1-2][0-9]|3[0-2]))?(\\s*,\\s*)?)+$"`
-	ConnectTimeout string   `key:"connectTimeout" constraint:"^[1-9]\\d*(ms|[smhdwMy])?$"`
-	TCPTimeout     string   `key:"tcpTimeout" constraint:"^[1-9]\\d*(ms|[smhdwMy])?$"`
-	ServiceIP      string
-	CertMappings   map[string]string `key:"certificates" constraint:"(?i)^((([a-z0-9]+(-*[a-z0-9]+)*)|((\\*\\.)?[a-z0-9]+(-*[a-z0-9]+)*\\.)+[a-z0-9]+(-*[a-z0-9]+)+):([a-z0-9]+(-*[a-z0-9]+)*)(\\s*,\\s*)?)+$"`
-	Certificates   map[string]*Certificate
-	Available      bool
-	Maintenance    bool            `key:"maintenance" constraint:"(?i)^(true|false)$"`
-	SSLConfig      *SSLConfig      `key:"ssl"`
-	Nginx          *NginxAppConfig `key:"nginx"`
+	Name                  string
+	Source                v1.ObjectReference
+	Created               time.Time
+	DomainPriority        int               `key:"domainPriority" constraint:"^(0|-?[1-9]\\d*)$"`
+	Domains               []string          `key:"domains" constraint:"(?i)^((([a-z0-9]+(-*[a-z0-9]+)*)|((\\*\\.)?[a-z0-9]+(-*[a-z0-9]+)*\\.)+[a-z0-9]+(-*[a-z0-9]+)+)(\\s*,\\s*)?)+$"`
+	Whitelist             []string          `key:"whitelist" constraint:"^((([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])\\.){3}([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])(\\/([0-9]|[1-2][0-9]|3[0-2]))?(\\s*,\\s*)?)+$"`
+	Blacklist             []string          `key:"blacklist" constraint:"^((([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])\\.){3}([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])(\\/([0-9]|[1-2][0-9]|3[0-2]))?(\\s*,\\s*)?)+$"`
+	CountryWhitelist      []string          `key:"countryWhitelist" constraint:"(?i)^([a-z]{2}(\\s*,\\s*)?)+$"`
+	CountryBlacklist      []string          `key:"countryBlacklist" constraint:"(?i)^([a-z]{2}(\\s*,\\s*)?)+$"`
+	PathWhitelistMappings map[string]string `key:"pathWhitelists" constraint:"^((/[^\\s:,;{}]*):(([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])\\.){3}([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])(\\/([0-9]|[1-2][0-9]|3[0-2]))?(\\s+(([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])\\.){3}([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])(\\/([0-9]|[1-2][0-9]|3[0-2]))?)*(\\s*,\\s*)?)+$"`
+	PathWhitelistMode     string            `key:"pathWhitelistMode" constraint:"^(extend|override)$"`
+	ConnectTimeout        string            `key:"connectTimeout" constraint:"^[1-9]\\d*(ms|[smhdwMy])?$"`
+	TCPTimeout            string            `key:"tcpTimeout" constraint:"^[1-9]\\d*(ms|[smhdwMy])?$"`
+	ServiceIP             string
+	BackendProtocol       string            `key:"backendProtocol" constraint:"^(http|https|grpc|grpcs)$"`
+	BackendPort           int               `key:"backendPort" constraint:"^([1-9]\\d{0,3}|[1-5]\\d{4}|6[0-4]\\d{3}|65[0-4]\\d{2}|655[0-2]\\d|6553[0-5])$"`
+	GRPCConfig            *GRPCConfig       `key:"grpc"`
+	BackendTLSConfig      *BackendTLSConfig `key:"backendTLS"`
+	UpstreamServers       []string
+	CertMappings          map[string]string `key:"certificates" constraint:"(?i)^((([a-z0-9]+(-*[a-z0-9]+)*)|((\\*\\.)?[a-z0-9]+(-*[a-z0-9]+)*\\.)+[a-z0-9]+(-*[a-z0-9]+)+):([a-z0-9]+(-*[a-z0-9]+)*)(\\s*,\\s*)?)+$"`
+	Certificates          map[string]*Certificate
+	Available             bool
+	Maintenance           bool               `key:"maintenance" constraint:"(?i)^(true|false)$"`
+	MaintenanceConfig     *MaintenanceConfig `key:"maintenance"`
+	SSLConfig             *SSLConfig         `key:"ssl"`
+	Nginx                 *NginxAppConfig    `key:"nginx"`
+	HeadersConfig         *HeadersConfig     `key:"headers"`
+	HeadersMode           string             `key:"headersMode" constraint:"^(extend|override)$"`
+	CORSConfig            *CORSConfig        `key:"cors"`
+	Redirects             []string           `key:"redirects" constraint:"^[^\\s,\"]*[^\\s,\"\\\\]\\s+[^\\s,\"]*[^\\s,\"\\\\]\\s+(301|302|307|308)(\\s*,\\s*[^\\s,\"]*[^\\s,\"\\\\]\\s+[^\\s,\"]*[^\\s,\"\\\\]\\s+(301|302|307|308))*$"`
+	RedirectRules         []*RedirectRule
+	Rewrites              []string `key:"rewrites" constraint:"^[^\\s,\"]*[^\\s,\"\\\\]\\s+[^\\s,\"]*[^\\s,\"\\\\](\\s*,\\s*[^\\s,\"]*[^\\s,\"\\\\]\\s+[^\\s,\"]*[^\\s,\"\\\\])*$"`
+	RewriteRules          []*RewriteRule
+	ErrorPagesConfig      *ErrorPagesConfig `key:"errorPages"`
+	LogSampleRate         string            `key:"logSampleRate" constraint:"^(0(\\.\\d+)?|1(\\.0+)?)$"`
+	Locations             []*Location
 }
 
 func newAppConfig(routerConfig *RouterConfig) (*AppConfig, error) {
@@ -145,14 +269,144 @@ func newAppConfig(routerConfig *RouterConfig) (*AppConfig, error) {
 		return nil, err
 	}
 	return &AppConfig{
-		ConnectTimeout: "30s",
-		TCPTimeout:     routerConfig.DefaultTimeout,
-		Certificates:   make(map[string]*Certificate, 0),
-		SSLConfig:      newSSLConfig(),
-		Nginx:          nginxConfig,
+		PathWhitelistMode: "extend",
+		ConnectTimeout:    "30s",
+		TCPTimeout:        routerConfig.DefaultTimeout,
+		Certificates:      make(map[string]*Certificate, 0),
+		SSLConfig:         newSSLConfig(),
+		Nginx:             nginxConfig,
+		HeadersConfig:     newHeadersConfig(),
+		HeadersMode:       "extend",
+		CORSConfig:        newCORSConfig(),
+		ErrorPagesConfig:  newErrorPagesConfig(),
+		MaintenanceConfig: newMaintenanceConfig(),
+		BackendProtocol:   "http",
+		BackendPort:       80,
+		GRPCConfig:        newGRPCConfig(),
+		BackendTLSConfig:  newBackendTLSConfig(),
+		LogSampleRate:     "1",
 	}, nil
 }
 
+// CORSConfig represents configuration options having to do with Cross-Origin Resource Sharing.
+type CORSConfig struct {
+	Enabled          bool     `key:"enabled" constraint:"(?i)^(true|false)$"`
+	AllowOrigins     []string `key:"allowOrigins" constraint:"(?i)^((\\*|https?://(\\*\\.)?[a-z0-9]+(-*[a-z0-9]+)*(\\.[a-z0-9]+(-*[a-z0-9]+)*)*(:[1-9]\\d*)?)(\\s*,\\s*)?)+$"`
+	AllowMethods     []string `key:"allowMethods" constraint:"^((GET|HEAD|POST|PUT|PATCH|DELETE|OPTIONS)(\\s*,\\s*)?)+$"`
+	AllowHeaders     []string `key:"allowHeaders" constraint:"^([A-Za-z0-9-]+(\\s*,\\s*)?)+$"`
+	ExposeHeaders    []string `key:"exposeHeaders" constraint:"^([A-Za-z0-9-]+(\\s*,\\s*)?)+$"`
+	AllowCredentials bool     `key:"allowCredentials" constraint:"(?i)^(true|false)$"`
+	MaxAge           int      `key:"maxAge" constraint:"^\\d+$"`
+	OriginRegex      string
+}
+
+func newCORSConfig() *CORSConfig {
+	return &CORSConfig{
+		Enabled:          false,
+		AllowMethods:     []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Accept", "Authorization", "Content-Type", "Origin", "X-Requested-With"},
+		AllowCredentials: false,
+		MaxAge:           86400, // 1 day
+	}
+}
+
+// RedirectRule represents a single redirect from requests matching a pattern to a target.  Patterns
+// beginning with "/" or "^/" are matched against the request URI; all others are matched against
+// the full request URL.
+type RedirectRule struct {
+	Source   string
+	Target   string
+	Status   int
+	MatchURL bool
+}
+
+func newRedirectRule(source string, target string, status int) *RedirectRule {
+	return &RedirectRule{
+		Source:   source,
+		Target:   target,
+		Status:   status,
+		MatchURL: !strings.HasPrefix(source, "/") && !strings.HasPrefix(source, "^/"),
+	}
+}
+
+// RewriteRule represents a single internal rewrite of request URIs matching a pattern.
+type RewriteRule struct {
+	Source string
+	Target string
+}
+
+func newRewriteRule(source string, target string) *RewriteRule {
+	return &RewriteRule{
+		Source: source,
+		Target: target,
+	}
+}
+
+// ErrorPagesConfig represents configuration options having to do with custom error and
+// maintenance pages.  Pages are read from the named config map, which may hold the keys
+// "maintenance.html", "404.html", "502.html", "503.html", and "504.html".
+type ErrorPagesConfig struct {
+	ConfigMap       string `key:"configMap" constraint:"^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$"`
+	InterceptErrors bool   `key:"interceptErrors" constraint:"(?i)^(true|false)$"`
+	Pages           map[string]string
+}
+
+func newErrorPagesConfig() *ErrorPagesConfig {
+	return &ErrorPagesConfig{
+		InterceptErrors: false,
+	}
+}
+
+// BackendTLSConfig represents configuration options having to do with TLS connections to an
+// app's back end.  The CA bundle and client certificate are read from the named secrets.
+type BackendTLSConfig struct {
+	ServerName        string `key:"serverName" constraint:"(?i)^([a-z0-9]+(-[a-z0-9]+)*\\.)*[a-z0-9]+(-[a-z0-9]+)*$"`
+	SNI               bool   `key:"sni" constraint:"(?i)^(true|false)$"`
+	CASecret          string `key:"caSecret" constraint:"^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$"`
+	VerifyDepth       int    `key:"verifyDepth" constraint:"^[1-9]\\d?$"`
+	ClientCertSecret  string `key:"clientCertSecret" constraint:"^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$"`
+	CA                string
+	ClientCertificate *Certificate
+}
+
+func newBackendTLSConfig() *BackendTLSConfig {
+	return &BackendTLSConfig{
+		SNI:         false,
+		VerifyDepth: 1,
+	}
+}
+
+// GRPCConfig represents configuration options specific to apps whose back ends speak gRPC.
+type GRPCConfig struct {
+	DefaultDeadline string `key:"defaultDeadline" constraint:"^[1-9]\\d{0,7}[HMSmun]$"`
+}
+
+func newGRPCConfig() *GRPCConfig {
+	return &GRPCConfig{}
+}
+
+// Location encapsulates the configuration for a single path prefix within an app.  Every
+// location proxies to the app's back end using the app's settings; a location with a non-empty
+// whitelist restricts access to that path using the complete, effective whitelist.
+type Location struct {
+	Path      string
+	Whitelist []string
+	// Paths of an app built from an Ingress may route to a service other than the app's own.
+	// Such locations carry their own upstream servers, availability, and, for back ends using
+	// TLS, the server name to expect of them.
+	Backend         string
+	UpstreamServers []string
+	Available       bool
+	ServerName      string
+}
+
+func newLocation(path string, whitelist []string) *Location {
+	return &Location{
+		Path:      path,
+		Whitelist: whitelist,
+	}
+}
+
 // BuilderConfig encapsulates the configuration of the deis-builder-- if it's in use.
 type BuilderConfig struct {
 	ConnectTimeout string `key:"connectTimeout" constraint:"^[1-9]\\d*(ms|[smhdwMy])?$"`
@@ -173,6 +427,22 @@ type Certificate struct {
 	Key  string
 }
 
+// redactedKey stands in for private keys in serialized certificates.
+const redactedKey = "REDACTED"
+
+// MarshalJSON implements json.Marshaler.  A certificate's private key is redacted so that router
+// configuration can be exposed without exposing key material.
+func (c Certificate) MarshalJSON() ([]byte, error) {
+	key := ""
+	if c.Key != "" {
+		key = redactedKey
+	}
+	return json.Marshal(struct {
+		Cert string
+		Key  string
+	}{c.Cert, key})
+}
+
 func newCertificate(cert string, key string) *Certificate {
 	return &Certificate{
 		Cert: cert,
@@ -180,6 +450,11 @@ func newCertificate(cert string, key string) *Certificate {
 	}
 }
 
+// isGRPC returns whether the app's back end speaks gRPC.
+func (a *AppConfig) isGRPC() bool {
+	return a.BackendProtocol == "grpc" || a.BackendProtocol == "grpcs"
+}
+
 // SSLConfig represents SSL-related configuration options.
 type SSLConfig struct {
 	Enforce           bool        `key:"enforce" constraint:"(?i)^(true|false)$"`
@@ -234,6 +509,9 @@ func newHSTSConfig() *HSTSConfig {
 // router implementations.
 type NginxAppConfig struct {
 	ProxyBuffersConfig *ProxyBuffersConfig `key:"proxyBuffers"`
+	CacheConfig        *CacheConfig        `key:"cache"`
+	RetryConfig        *RetryConfig        `key:"retry"`
+	KeepaliveConfig    *KeepaliveConfig    `key:"keepalive"`
 }
 
 func newNginxAppConfig(routerConfig *RouterConfig) (*NginxAppConfig, error) {
@@ -243,9 +521,84 @@ func newNginxAppConfig(routerConfig *RouterConfig) (*NginxAppConfig, error) {
 	}
 	return &NginxAppConfig{
 		ProxyBuffersConfig: proxyBuffersConfig,
+		CacheConfig:        newCacheConfig(),
+		RetryConfig:        newRetryConfig(),
+		KeepaliveConfig:    newKeepaliveConfig(),
 	}, nil
 }
 
+// CacheZone represents a single proxy cache zone that apps may opt into.
+type CacheZone struct {
+	Name     string
+	Path     string
+	Size     string
+	Inactive string
+}
+
+func newCacheZone(name string, path string, size string, inactive string) *CacheZone {
+	return &CacheZone{
+		Name:     name,
+		Path:     path,
+		Size:     size,
+		Inactive: inactive,
+	}
+}
+
+// CacheConfig represents configuration options having to do with caching an app's responses in
+// one of the router's cache zones.
+type CacheConfig struct {
+	Enabled              bool     `key:"enabled" constraint:"(?i)^(true|false)$"`
+	Zone                 string   `key:"zone" constraint:"^[a-z0-9_]+$"`
+	Key                  string   `key:"key" constraint:"^[^\\s\"\\\\;]+$"`
+	Valid                []string `key:"valid" constraint:"^(((any|[1-5][0-9]{2})\\s+)*[1-9]\\d*(ms|[smhdwMy])?(\\s*,\\s*)?)+$"`
+	Bypass               []string `key:"bypass" constraint:"^(\\$[A-Za-z0-9_]+(\\s*,\\s*)?)+$"`
+	StaleWhileRevalidate bool     `key:"staleWhileRevalidate" constraint:"(?i)^(true|false)$"`
+	StatusHeader         string   `key:"statusHeader" constraint:"^[A-Za-z0-9-]*$"`
+}
+
+func newCacheConfig() *CacheConfig {
+	return &CacheConfig{
+		Enabled:              false,
+		Key:                  "$scheme$request_method$host$request_uri",
+		StaleWhileRevalidate: false,
+		StatusHeader:         "X-Cache-Status",
+	}
+}
+
+// RetryConfig represents configuration options having to do with retrying requests that fail to
+// reach an app.
+type RetryConfig struct {
+	Conditions    []string `key:"conditions" constraint:"^((error|timeout|invalid_header|http_500|http_502|http_503|http_504|http_403|http_404|http_429|off)(\\s*,\\s*)?)+$"`
+	Tries         int      `key:"tries" constraint:"^[1-9]\\d?$"`
+	Timeout       string   `key:"timeout" constraint:"^(0|[1-9]\\d*(ms|[smhdwMy])?)$"`
+	NonIdempotent bool     `key:"nonIdempotent" constraint:"(?i)^(true|false)$"`
+}
+
+func newRetryConfig() *RetryConfig {
+	return &RetryConfig{
+		Conditions:    []string{"error", "timeout"},
+		Tries:         1,
+		Timeout:       "0",
+		NonIdempotent: false,
+	}
+}
+
+// KeepaliveConfig represents configuration options having to do with pooling connections to an
+// app's back end.
+type KeepaliveConfig struct {
+	Connections int    `key:"connections" constraint:"^\\d+$"`
+	Timeout     string `key:"timeout" constraint:"^[1-9]\\d*(ms|[smhdwMy])?$"`
+	Requests    int    `key:"requests" constraint:"^[1-9]\\d*$"`
+}
+
+func newKeepaliveConfig() *KeepaliveConfig {
+	return &KeepaliveConfig{
+		Connections: 0,
+		Timeout:     "60s",
+		Requests:    100,
+	}
+}
+
 // ProxyBuffersConfig represents configuration options having to do with Nginx
 // proxy buffers.
 type ProxyBuffersConfig struct {
@@ -278,19 +631,48 @@ func newProxyBuffersConfig(proxyBuffersConfig *ProxyBuffersConfig) (*ProxyBuffer
 	}, nil
 }
 
+// HeadersConfig represents configuration options having to do with manipulating the headers of
+// proxied requests and of responses.
+type HeadersConfig struct {
+	SetRequest   map[string]string `key:"setRequest" constraint:"^([A-Za-z0-9-]+:[^\",\\\\]*[^\",\\\\\\s][^\",\\\\]*(\\s*,\\s*)?)+$"`
+	HideRequest  []string          `key:"hideRequest" constraint:"^([A-Za-z0-9-]+(\\s*,\\s*)?)+$"`
+	AddResponse  map[string]string `key:"addResponse" constraint:"^([A-Za-z0-9-]+:[^\",\\\\]*[^\",\\\\\\s][^\",\\\\]*(\\s*,\\s*)?)+$"`
+	SetResponse  map[string]string `key:"setResponse" constraint:"^([A-Za-z0-9-]+:[^\",\\\\]*[^\",\\\\\\s][^\",\\\\]*(\\s*,\\s*)?)+$"`
+	HideResponse []string          `key:"hideResponse" constraint:"^([A-Za-z0-9-]+(\\s*,\\s*)?)+$"`
+}
+
+func newHeadersConfig() *HeadersConfig {
+	return &HeadersConfig{}
+}
+
+// RejectedAnnotation describes an annotation whose value was skipped, in favor of the default,
+// because it doesn't satisfy the constraint on it.
+type RejectedAnnotation struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Key       string
+	Value     string
+}
+
 // Build creates a RouterConfig configuration object by querying the k8s API for
 // relevant metadata concerning itself and all routable services.
-func Build(kubeClient *kubernetes.Clientset) (*RouterConfig, error) {
+func Build(kubeClient kubernetes.Interface) (*RouterConfig, error) {
 	// Get all relevant information from k8s:
 	//   deis-router deployment
-	//   All services with label "routable=true"
+	//   All services with label "routable=true" assigned to this router's class
 	//   deis-builder service, if it exists
+	//   All Ingresses
 	// These are used to construct a model...
 	routerDeployment, err := getDeployment(kubeClient)
 	if err != nil {
 		return nil, err
 	}
-	appServices, err := getAppServices(kubeClient)
+	appNamespaces, err := getAppNamespaces(kubeClient)
+	if err != nil {
+		return nil, err
+	}
+	appServices, err := getAppServices(kubeClient, appNamespaces)
 	if err != nil {
 		return nil, err
 	}
@@ -299,43 +681,99 @@ func Build(kubeClient *kubernetes.Clientset) (*RouterConfig, error) {
 	if err != nil {
 		return nil, err
 	}
-	platformCertSecret, err := getSecret(kubeClient, "deis-router-platform-cert", namespace)
+	platformCertSecret, err := getSecret(kubeClient, platformCertSecretName, namespace)
 	if err != nil {
 		return nil, err
 	}
-	dhParamSecret, err := getSecret(kubeClient, "deis-router-dhparam", namespace)
+	dhParamSecret, err := getSecret(kubeClient, dhParamSecretName, namespace)
+	if err != nil {
+		return nil, err
+	}
+	ingresses, err := getIngresses(kubeClient, appNamespaces)
 	if err != nil {
 		return nil, err
 	}
 	// Build the model...
-	routerConfig, err := build(kubeClient, routerDeployment, platformCertSecret, dhParamSecret, appServices, builderService)
+	routerConfig, err := build(kubeClient, routerDeployment, platformCertSecret, dhParamSecret, appServices, builderService, ingresses)
 	if err != nil {
 		return nil, err
 	}
 	return routerConfig, nil
 }
 
-func getDeployment(kubeClient *kubernetes.Clientset) (*v1beta1ext.Deployment, error) {
-	deployment, err := kubeClient.Extensions().Deployments(namespace).Get("deis-router")
+func getDeployment(kubeClient kubernetes.Interface) (*v1beta1ext.Deployment, error) {
+	deployment, err := kubeClient.Extensions().Deployments(namespace).Get(deploymentName)
 	if err != nil {
 		return nil, err
 	}
 	return deployment, nil
 }
 
-func getAppServices(kubeClient *kubernetes.Clientset) (*v1.ServiceList, error) {
-	serviceClient := kubeClient.Services(api.NamespaceAll)
-	services, err := serviceClient.List(listOptions)
-	if err != nil {
-		return nil, err
+// getAppNamespaces returns the namespaces in which to look for routable services and Ingresses.
+// If the router isn't limited to particular namespaces, this is just api.NamespaceAll.
+func getAppNamespaces(kubeClient kubernetes.Interface) ([]string, error) {
+	if namespaceListOptions == nil && len(allowedNamespaces) == 0 {
+		return []string{api.NamespaceAll}, nil
+	}
+	candidates := allowedNamespaces
+	if namespaceListOptions != nil {
+		namespaces, err := kubeClient.Core().Namespaces().List(*namespaceListOptions)
+		if err != nil {
+			return nil, err
+		}
+		candidates = make([]string, len(namespaces.Items))
+		for i, namespace := range namespaces.Items {
+			candidates[i] = namespace.Name
+		}
+	}
+	return scopeNamespaces(candidates, allowedNamespaces, excludedNamespaces), nil
+}
+
+// scopeNamespaces returns those of the candidate namespaces that are allowed (if an allow list is
+// given at all) and not excluded.
+func scopeNamespaces(candidates []string, allowed []string, excluded []string) []string {
+	scoped := []string{}
+	for _, candidate := range candidates {
+		if (len(allowed) == 0 || containsString(allowed, candidate)) && !containsString(excluded, candidate) {
+			scoped = append(scoped, candidate)
+		}
+	}
+	return scoped
+}
+
+func getAppServices(kubeClient kubernetes.Interface, namespaces []string) (*v1.ServiceList, error) {
+	services := &v1.ServiceList{}
+	for _, namespace := range namespaces {
+		serviceClient := kubeClient.Core().Services(namespace)
+		namespaceServices, err := serviceClient.List(listOptions)
+		if err != nil {
+			return nil, err
+		}
+		for _, service := range namespaceServices.Items {
+			if !containsString(excludedNamespaces, service.Namespace) {
+				services.Items = append(services.Items, service)
+			}
+		}
 	}
-	return services, nil
+	return filterServicesByClass(services, routerClass), nil
+}
+
+// filterServicesByClass returns only those of the given services that are assigned to router
+// instances of the given class.
+func filterServicesByClass(services *v1.ServiceList, class string) *v1.ServiceList {
+	filtered := &v1.ServiceList{}
+	for _, service := range services.Items {
+		if service.Annotations[routerClassAnnotation] == class {
+			filtered.Items = append(filtered.Items, service)
+		}
+	}
+	return filtered
 }
 
 // getBuilderService will return the service named "deis-builder" from the same namespace as
 // the router, but will return nil (without error) if no such service exists.
-func getBuilderService(kubeClient *kubernetes.Clientset) (*v1.Service, error) {
-	serviceClient := kubeClient.Services(namespace)
+func getBuilderService(kubeClient kubernetes.Interface) (*v1.Service, error) {
+	serviceClient := kubeClient.Core().Services(namespace)
 	service, err := serviceClient.Get("deis-builder")
 	if err != nil {
 		statusErr, ok := err.(*errors.StatusError)
@@ -349,8 +787,8 @@ func getBuilderService(kubeClient *kubernetes.Clientset) (*v1.Service, error) {
 	return service, nil
 }
 
-func getSecret(kubeClient *kubernetes.Clientset, name string, ns string) (*v1.Secret, error) {
-	secretClient := kubeClient.Secrets(ns)
+func getSecret(kubeClient kubernetes.Interface, name string, ns string) (*v1.Secret, error) {
+	secretClient := kubeClient.Core().Secrets(ns)
 	secret, err := secretClient.Get(name)
 	if err != nil {
 		statusErr, ok := err.(*errors.StatusError)
@@ -364,7 +802,22 @@ func getSecret(kubeClient *kubernetes.Clientset, name string, ns string) (*v1.Se
 	return secret, nil
 }
 
-func build(kubeClient *kubernetes.Clientset, routerDeployment *v1beta1ext.Deployment, platformCertSecret *v1.Secret, dhParamSecret *v1.Secret, appServices *v1.ServiceList, builderService *v1.Service) (*RouterConfig, error) {
+func getConfigMap(kubeClient kubernetes.Interface, name string, ns string) (*v1.ConfigMap, error) {
+	configMapClient := kubeClient.Core().ConfigMaps(ns)
+	configMap, err := configMapClient.Get(name)
+	if err != nil {
+		statusErr, ok := err.(*errors.StatusError)
+		// If the issue is just that no such config map was found, that's ok.
+		if ok && statusErr.Status().Code == 404 {
+			// We'll just return nil instead of a found *api.ConfigMap
+			return nil, nil
+		}
+		return nil, err
+	}
+	return configMap, nil
+}
+
+func build(kubeClient kubernetes.Interface, routerDeployment *v1beta1ext.Deployment, platformCertSecret *v1.Secret, dhParamSecret *v1.Secret, appServices *v1.ServiceList, builderService *v1.Service, ingresses *v1beta1ext.IngressList) (*RouterConfig, error) {
 	routerConfig, err := buildRouterConfig(routerDeployment, platformCertSecret, dhParamSecret)
 	if err != nil {
 		return nil, err
@@ -378,8 +831,19 @@ func build(kubeClient *kubernetes.Clientset, routerDeployment *v1beta1ext.Deploy
 			routerConfig.AppConfigs = append(routerConfig.AppConfigs, appConfig)
 		}
 	}
+	for _, ingress := range ingresses.Items {
+		if ingress.Annotations[ingressClassAnnotation] != routerConfig.IngressClass {
+			continue
+		}
+		appConfigs, err := buildIngressAppConfigs(kubeClient, ingress, routerConfig)
+		if err != nil {
+			return nil, err
+		}
+		routerConfig.AppConfigs = append(routerConfig.AppConfigs, appConfigs...)
+	}
+	resolveDomainConflicts(routerConfig)
 	if builderService != nil {
-		builderConfig, err := buildBuilderConfig(builderService)
+		builderConfig, err := buildBuilderConfig(builderService, routerConfig)
 		if err != nil {
 			return nil, err
 		}
@@ -387,6 +851,31 @@ func build(kubeClient *kubernetes.Clientset, routerDeployment *v1beta1ext.Deploy
 			routerConfig.BuilderConfig = builderConfig
 		}
 	}
+	// Streams and TLS passthroughs are built last so that collisions with the builder's port can
+	// be detected.
+	for _, appService := range appServices.Items {
+		passthroughConfig, err := buildPassthroughConfig(appService, routerConfig)
+		if err != nil {
+			return nil, err
+		}
+		if passthroughConfig != nil {
+			for _, err := range addPassthroughConfig(routerConfig, passthroughConfig) {
+				log.Printf("WARN: Not passing TLS through: %v.\n", err)
+				addProblem(routerConfig, passthroughConfig.Source, ReasonDomainConflict, "Not passing TLS through: %v.", err)
+			}
+		}
+		streamConfig, err := buildStreamConfig(appService, routerConfig)
+		if err != nil {
+			return nil, err
+		}
+		if streamConfig != nil {
+			if err := addStreamConfig(routerConfig, streamConfig); err != nil {
+				log.Printf("WARN: Not routing stream: %v.\n", err)
+				addProblem(routerConfig, streamConfig.Source, ReasonPortConflict, "Not routing stream: %v.", err)
+			}
+		}
+	}
+	reportDomainConflicts(routerConfig)
 	return routerConfig, nil
 }
 
@@ -395,7 +884,7 @@ func buildRouterConfig(routerDeployment *v1beta1.Deployment, platformCertSecret
 	if err != nil {
 		return nil, err
 	}
-	err = modeler.MapToModel(routerDeployment.Annotations, "nginx", routerConfig)
+	err = mapAnnotations(routerConfig, "Deployment", routerDeployment.ObjectMeta, "nginx", routerConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -413,26 +902,70 @@ func buildRouterConfig(routerDeployment *v1beta1.Deployment, platformCertSecret
 		}
 		routerConfig.SSLConfig.DHParam = dhParam
 	}
+	routerConfig.CacheZoneConfigs = buildCacheZones(routerConfig)
+	routerConfig.AccessLogConfig.Fields = buildLogFields(routerConfig.AccessLogConfig)
 	return routerConfig, nil
 }
 
-func buildAppConfig(kubeClient *kubernetes.Clientset, service v1.Service, routerConfig *RouterConfig) (*AppConfig, error) {
-	appConfig, err := newAppConfig(routerConfig)
+// mapAnnotations populates the given model from the annotations of the given object, recording
+// any values that were skipped for failing validation in the router's configuration.
+func mapAnnotations(routerConfig *RouterConfig, kind string, meta v1.ObjectMeta, context string, out interface{}) error {
+	warnings, err := modeler.MapToModelWithWarnings(meta.Annotations, context, out)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	appConfig.Name = service.Labels["app"]
+	for _, warning := range warnings {
+		// An Ingress's annotations are mapped once for each of its hosts.
+		if findRejectedAnnotation(routerConfig, kind, meta, warning.Field()) != nil {
+			continue
+		}
+		routerConfig.RejectedAnnotations = append(routerConfig.RejectedAnnotations, &RejectedAnnotation{
+			Kind:      kind,
+			Namespace: meta.Namespace,
+			Name:      meta.Name,
+			Key:       warning.Field(),
+			Value:     warning.Value(),
+		})
+		addProblem(routerConfig, newObjectReference(kind, meta), ReasonInvalidAnnotation, "Ignoring value \"%s\" of annotation %s, which is invalid; using the default instead.", warning.Value(), warning.Field())
+	}
+	return nil
+}
+
+func findRejectedAnnotation(routerConfig *RouterConfig, kind string, meta v1.ObjectMeta, key string) *RejectedAnnotation {
+	for _, rejectedAnnotation := range routerConfig.RejectedAnnotations {
+		if rejectedAnnotation.Kind == kind && rejectedAnnotation.Namespace == meta.Namespace && rejectedAnnotation.Name == meta.Name && rejectedAnnotation.Key == key {
+			return rejectedAnnotation
+		}
+	}
+	return nil
+}
+
+// appName returns the name under which the routable service or Ingress with the given metadata is
+// known to the router.
+func appName(meta v1.ObjectMeta) string {
+	name := meta.Labels["app"]
 	// If we didn't get the app name from the app label, fall back to inferring the app name from
 	// the service's own name.
-	if appConfig.Name == "" {
-		appConfig.Name = service.Name
+	if name == "" {
+		name = meta.Name
 	}
 	// if app name and Namespace are not same then combine the two as it
 	// makes deis services (as an example) clearer, such as deis/controller
-	if appConfig.Name != service.Namespace {
-		appConfig.Name = service.Namespace + "/" + appConfig.Name
+	if name != meta.Namespace {
+		name = meta.Namespace + "/" + name
+	}
+	return name
+}
+
+func buildAppConfig(kubeClient kubernetes.Interface, service v1.Service, routerConfig *RouterConfig) (*AppConfig, error) {
+	appConfig, err := newAppConfig(routerConfig)
+	if err != nil {
+		return nil, err
 	}
-	err = modeler.MapToModel(service.Annotations, "", appConfig)
+	appConfig.Name = appName(service.ObjectMeta)
+	appConfig.Source = newObjectReference("Service", service.ObjectMeta)
+	appConfig.Created = service.CreationTimestamp.Time
+	err = mapAnnotations(routerConfig, "Service", service.ObjectMeta, "", appConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -441,6 +974,107 @@ func buildAppConfig(kubeClient *kubernetes.Clientset, service v1.Service, router
 	if len(appConfig.Domains) == 0 {
 		return nil, nil
 	}
+	err = completeAppConfig(kubeClient, appConfig, routerConfig, service.Namespace, service.Name)
+	if err != nil {
+		return nil, err
+	}
+	appConfig.ServiceIP = service.Spec.ClusterIP
+	appConfig.Available, err = isServiceAvailable(kubeClient, service.Namespace, service.Name)
+	if err != nil {
+		return nil, err
+	}
+	if appConfig.Available {
+		appConfig.UpstreamServers = buildUpstreamServers(appConfig)
+	} else {
+		addProblem(routerConfig, appConfig.Source, ReasonEndpointsUnavailable, "Service %s/%s has no ready endpoints; requests for %s will fail.", service.Namespace, service.Name, strings.Join(appConfig.Domains, ", "))
+	}
+	return appConfig, nil
+}
+
+// completeAppConfig validates and supplements the options read from an app's annotations,
+// fetching any secrets and config maps they refer to from the given namespace.  serviceName is
+// the name of the service the app's requests are (by default) proxied to.
+func completeAppConfig(kubeClient kubernetes.Interface, appConfig *AppConfig, routerConfig *RouterConfig, namespace string, serviceName string) error {
+	// Country-based rules can't be enforced without a GeoIP database.  Rather than emit
+	// configuration nginx would refuse to load, drop them and say so.
+	if !routerConfig.GeoIPConfig.Enabled && (len(appConfig.CountryWhitelist) > 0 || len(appConfig.CountryBlacklist) > 0) {
+		log.Printf("WARN: GeoIP is not enabled on the router; ignoring country whitelist and blacklist for app %s.\n", appConfig.Name)
+		appConfig.CountryWhitelist = nil
+		appConfig.CountryBlacklist = nil
+	}
+	// Caching requires a cache zone defined on the router.
+	if cacheConfig := appConfig.Nginx.CacheConfig; cacheConfig.Enabled && !hasCacheZone(routerConfig, cacheConfig.Zone) {
+		log.Printf("WARN: Cache zone \"%s\" is not defined on the router; not caching responses for app %s.\n", cacheConfig.Zone, appConfig.Name)
+		cacheConfig.Enabled = false
+	}
+	// Retries can be turned off, but "off" can't be combined with any other condition.
+	if retryConfig := appConfig.Nginx.RetryConfig; len(retryConfig.Conditions) > 1 {
+		for _, condition := range retryConfig.Conditions {
+			if condition == "off" {
+				log.Printf("WARN: Retry condition \"off\" cannot be combined with other conditions; disabling retries for app %s.\n", appConfig.Name)
+				retryConfig.Conditions = []string{"off"}
+				break
+			}
+		}
+	}
+	if retryConfig := appConfig.Nginx.RetryConfig; len(retryConfig.Conditions) == 1 && retryConfig.Conditions[0] == "off" {
+		retryConfig.NonIdempotent = false
+	}
+	// gRPC back ends rule out some features and require others.
+	if appConfig.isGRPC() {
+		if !routerConfig.HTTP2Enabled {
+			log.Printf("WARN: HTTP/2 is not enabled on the router; gRPC clients will be unable to reach app %s.\n", appConfig.Name)
+		}
+		if appConfig.Nginx.CacheConfig.Enabled {
+			log.Printf("WARN: Responses from gRPC back ends cannot be cached; not caching responses for app %s.\n", appConfig.Name)
+			appConfig.Nginx.CacheConfig.Enabled = false
+		}
+		if appConfig.ErrorPagesConfig.ConfigMap != "" {
+			log.Printf("WARN: Custom error pages cannot be served to gRPC clients; ignoring error pages for app %s.\n", appConfig.Name)
+			appConfig.ErrorPagesConfig = newErrorPagesConfig()
+		}
+	}
+	// TLS to the back end only applies to the protocols that use it.
+	if appConfig.BackendProtocol == "https" || appConfig.BackendProtocol == "grpcs" {
+		backendTLSConfig := appConfig.BackendTLSConfig
+		if backendTLSConfig.ServerName == "" && serviceName != "" {
+			backendTLSConfig.ServerName = serviceDNSName(serviceName, namespace)
+		}
+		if backendTLSConfig.CASecret != "" {
+			caSecret, err := getSecret(kubeClient, backendTLSConfig.CASecret, namespace)
+			if err != nil {
+				return err
+			}
+			if caSecret != nil {
+				backendTLSConfig.CA = buildCA(caSecret, appConfig.Name)
+			} else {
+				log.Printf("WARN: The k8s secret %s intended to convey the %s back end CA was not found.\n", backendTLSConfig.CASecret, appConfig.Name)
+				addProblem(routerConfig, appConfig.Source, ReasonSecretNotFound, "The secret %s holding the back end CA was not found.", backendTLSConfig.CASecret)
+			}
+		}
+		if backendTLSConfig.ClientCertSecret != "" {
+			clientCertSecret, err := getSecret(kubeClient, backendTLSConfig.ClientCertSecret, namespace)
+			if err != nil {
+				return err
+			}
+			if clientCertSecret != nil {
+				backendTLSConfig.ClientCertificate, err = buildCertificate(clientCertSecret, fmt.Sprintf("%s back end client", appConfig.Name))
+				if err != nil {
+					return err
+				}
+			} else {
+				log.Printf("WARN: The k8s secret %s intended to convey the %s back end client certificate was not found.\n", backendTLSConfig.ClientCertSecret, appConfig.Name)
+				addProblem(routerConfig, appConfig.Source, ReasonSecretNotFound, "The secret %s holding the back end client certificate was not found.", backendTLSConfig.ClientCertSecret)
+			}
+		}
+	} else if appConfig.BackendTLSConfig.CASecret != "" || appConfig.BackendTLSConfig.ClientCertSecret != "" {
+		log.Printf("WARN: Back end TLS options only apply to the https and grpcs back end protocols; ignoring them for app %s.\n", appConfig.Name)
+	}
+	// Scheduled maintenance is re-evaluated every time the model is built, so apps enter and leave
+	// maintenance on their own as windows open and close.
+	if !appConfig.Maintenance && inMaintenanceWindow(appConfig.MaintenanceConfig, now(), appConfig.Name) {
+		appConfig.Maintenance = true
+	}
 	// Step through the domains, and decide which cert, if any, will be used for securing each.
 	// For each that is a FQDN, we'll look to see if a corresponding cert-bearing secret also
 	// exists.  If so, that will be used.  If a domain isn't an FQDN we will use the default cert--
@@ -450,36 +1084,283 @@ func buildAppConfig(kubeClient *kubernetes.Clientset, service v1.Service, router
 			// Look for a cert-bearing secret for this domain.
 			if certMapping, ok := appConfig.CertMappings[domain]; ok {
 				secretName := fmt.Sprintf("%s-cert", certMapping)
-				certSecret, err := getSecret(kubeClient, secretName, service.Namespace)
+				certSecret, err := getSecret(kubeClient, secretName, namespace)
 				if err != nil {
-					return nil, err
+					return err
 				}
 				if certSecret != nil {
 					certificate, err := buildCertificate(certSecret, domain)
 					if err != nil {
-						return nil, err
+						return err
 					}
 					appConfig.Certificates[domain] = certificate
+				} else {
+					log.Printf("WARN: The k8s secret %s intended to convey the certificate for domain %s was not found.\n", secretName, domain)
+					addProblem(routerConfig, appConfig.Source, ReasonSecretNotFound, "The secret %s holding the certificate for domain %s was not found.", secretName, domain)
 				}
 			}
 		} else {
 			appConfig.Certificates[domain] = routerConfig.PlatformCertificate
 		}
 	}
-	appConfig.ServiceIP = service.Spec.ClusterIP
-	endpointsClient := kubeClient.Endpoints(service.Namespace)
-	endpoints, err := endpointsClient.Get(service.Name)
+	appConfig.HeadersConfig = buildHeadersConfig(appConfig, routerConfig)
+	if appConfig.CORSConfig.Enabled {
+		if len(appConfig.CORSConfig.AllowOrigins) == 0 {
+			log.Printf("WARN: CORS is enabled for app %s, but no origins are allowed.\n", appConfig.Name)
+		}
+		appConfig.CORSConfig.OriginRegex = buildOriginRegex(appConfig.CORSConfig.AllowOrigins)
+	}
+	appConfig.RedirectRules = buildRedirectRules(appConfig)
+	appConfig.RewriteRules = buildRewriteRules(appConfig)
+	appConfig.Locations = buildLocations(appConfig, routerConfig)
+	if appConfig.ErrorPagesConfig.ConfigMap != "" {
+		errorPagesConfigMap, err := getConfigMap(kubeClient, appConfig.ErrorPagesConfig.ConfigMap, namespace)
+		if err != nil {
+			return err
+		}
+		if errorPagesConfigMap != nil {
+			appConfig.ErrorPagesConfig.Pages = buildErrorPages(errorPagesConfigMap, appConfig.Name)
+		} else {
+			log.Printf("WARN: The k8s config map %s intended to convey the %s error pages was not found.\n", appConfig.ErrorPagesConfig.ConfigMap, appConfig.Name)
+			addProblem(routerConfig, appConfig.Source, ReasonConfigMapNotFound, "The config map %s holding custom error pages was not found.", appConfig.ErrorPagesConfig.ConfigMap)
+		}
+	}
+	return nil
+}
+
+// serviceDNSName returns the name by which the given service is known within the cluster, which
+// back ends using TLS are expected to present by default.
+func serviceDNSName(serviceName string, namespace string) string {
+	return fmt.Sprintf("%s.%s.svc.cluster.local", serviceName, namespace)
+}
+
+// isServiceAvailable returns whether the named service has any endpoints to route requests to.
+func isServiceAvailable(kubeClient kubernetes.Interface, namespace string, serviceName string) (bool, error) {
+	endpointsClient := kubeClient.Core().Endpoints(namespace)
+	endpoints, err := endpointsClient.Get(serviceName)
 	if err != nil {
-		return nil, err
+		statusErr, ok := err.(*errors.StatusError)
+		// A service without a selector has no endpoints object until one is created for it.
+		if ok && statusErr.Status().Code == 404 {
+			return false, nil
+		}
+		return false, err
 	}
-	appConfig.Available = len(endpoints.Subsets) > 0 && len(endpoints.Subsets[0].Addresses) > 0
-	return appConfig, nil
+	return len(endpoints.Subsets) > 0 && len(endpoints.Subsets[0].Addresses) > 0, nil
+}
+
+// buildUpstreamServers returns the servers to list in the app's upstream.  Requests are always
+// proxied to the app's service IP, which k8s balances across the app's pods.  nginx never makes
+// more tries than its upstream has servers, so the service IP is listed once per permitted try,
+// with max_fails=0 so that a failed try doesn't take "the other servers" out of rotation.
+//
+// This is a trade-off: every try goes to the same kube-proxy VIP, so a retry only reaches a
+// different pod if kube-proxy balances its connection there.  Without keepalive, each try opens a
+// new connection and usually does.  With keepalive, a try may instead reuse an idle pooled
+// connection, which may well lead to the pod that just failed.  Listing the pods' endpoints
+// directly would avoid this, but would bypass k8s's own balancing and readiness handling.
+func buildUpstreamServers(appConfig *AppConfig) []string {
+	return buildServiceUpstreamServers(appConfig, appConfig.ServiceIP, appConfig.BackendPort)
+}
+
+// buildServiceUpstreamServers returns the upstream servers through which the given app reaches
+// the service at the given address, honoring the app's retry options.
+func buildServiceUpstreamServers(appConfig *AppConfig, serviceIP string, port int) []string {
+	retryConfig := appConfig.Nginx.RetryConfig
+	tries := retryConfig.Tries
+	if len(retryConfig.Conditions) == 1 && retryConfig.Conditions[0] == "off" {
+		tries = 1
+	}
+	upstreamServers := make([]string, tries)
+	for i := range upstreamServers {
+		upstreamServers[i] = fmt.Sprintf("%s:%d", serviceIP, port)
+	}
+	return upstreamServers
+}
+
+// buildLocations returns the locations to be rendered for the app: the root location, followed by
+// a location for each path-specific whitelist, ordered by path.
+func buildLocations(appConfig *AppConfig, routerConfig *RouterConfig) []*Location {
+	locations := []*Location{newLocation("/", nil)}
+	paths := make([]string, 0, len(appConfig.PathWhitelistMappings))
+	for path := range appConfig.PathWhitelistMappings {
+		if path == "/" {
+			log.Printf("WARN: Ignoring path-specific whitelist for \"/\" on app %s; use the app whitelist instead.\n", appConfig.Name)
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		pathWhitelist := strings.Fields(appConfig.PathWhitelistMappings[path])
+		var whitelist []string
+		if appConfig.PathWhitelistMode == "extend" {
+			// Mirror the whitelist that applies to the app as a whole, then add to it.
+			if len(appConfig.Whitelist) == 0 || routerConfig.WhitelistMode == "extend" {
+				whitelist = append(whitelist, routerConfig.DefaultWhitelist...)
+			}
+			whitelist = append(whitelist, appConfig.Whitelist...)
+		}
+		whitelist = append(whitelist, pathWhitelist...)
+		locations = append(locations, newLocation(path, whitelist))
+	}
+	return locations
+}
+
+// buildHeadersConfig returns the effective header configuration for the app: the router-wide
+// defaults (unless the app overrides them), combined with the app's own.  Header names are
+// canonicalized so that the app can replace a default regardless of how either was capitalized.
+func buildHeadersConfig(appConfig *AppConfig, routerConfig *RouterConfig) *HeadersConfig {
+	headersConfig := newHeadersConfig()
+	if appConfig.HeadersMode == "extend" {
+		mergeHeadersConfig(headersConfig, routerConfig.HeadersConfig)
+	}
+	mergeHeadersConfig(headersConfig, appConfig.HeadersConfig)
+	// The router sets these request headers itself.  Letting annotations set or hide them as well
+	// would result in duplicated or missing headers upstream.
+	var hideRequest []string
+	for _, name := range headersConfig.HideRequest {
+		if routerManagedRequestHeaders[name] {
+			log.Printf("WARN: Request header %s is managed by the router and cannot be hidden for app %s.\n", name, appConfig.Name)
+			continue
+		}
+		hideRequest = append(hideRequest, name)
+	}
+	headersConfig.HideRequest = hideRequest
+	for name := range headersConfig.SetRequest {
+		if routerManagedRequestHeaders[name] {
+			log.Printf("WARN: Request header %s is managed by the router and cannot be set for app %s.\n", name, appConfig.Name)
+			delete(headersConfig.SetRequest, name)
+		}
+	}
+	return headersConfig
+}
+
+func mergeHeadersConfig(dst *HeadersConfig, src *HeadersConfig) {
+	dst.SetRequest = mergeHeaderMaps(dst.SetRequest, src.SetRequest)
+	dst.HideRequest = mergeHeaderLists(dst.HideRequest, src.HideRequest)
+	dst.AddResponse = mergeHeaderMaps(dst.AddResponse, src.AddResponse)
+	dst.SetResponse = mergeHeaderMaps(dst.SetResponse, src.SetResponse)
+	dst.HideResponse = mergeHeaderLists(dst.HideResponse, src.HideResponse)
+}
+
+func mergeHeaderMaps(dst map[string]string, src map[string]string) map[string]string {
+	for name, value := range src {
+		if dst == nil {
+			dst = make(map[string]string, len(src))
+		}
+		dst[textproto.CanonicalMIMEHeaderKey(name)] = value
+	}
+	return dst
+}
+
+func mergeHeaderLists(dst []string, src []string) []string {
+	for _, name := range src {
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		found := false
+		for _, existing := range dst {
+			if existing == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, name)
+		}
+	}
+	return dst
+}
+
+// buildRedirectRules parses the app's redirects, in order, skipping any whose pattern is malformed.
+func buildRedirectRules(appConfig *AppConfig) []*RedirectRule {
+	var redirectRules []*RedirectRule
+	for _, redirect := range appConfig.Redirects {
+		tokens := strings.Fields(redirect)
+		if err := checkPattern(tokens[0]); err != nil {
+			log.Printf("WARN: Skipping redirect \"%s\" for app %s: %v.\n", redirect, appConfig.Name, err)
+			continue
+		}
+		status, err := strconv.Atoi(tokens[2])
+		if err != nil {
+			log.Printf("WARN: Skipping redirect \"%s\" for app %s: %v.\n", redirect, appConfig.Name, err)
+			continue
+		}
+		redirectRules = append(redirectRules, newRedirectRule(tokens[0], tokens[1], status))
+	}
+	return redirectRules
+}
+
+// buildRewriteRules parses the app's rewrites, in order, skipping any whose pattern is malformed.
+func buildRewriteRules(appConfig *AppConfig) []*RewriteRule {
+	var rewriteRules []*RewriteRule
+	for _, rewrite := range appConfig.Rewrites {
+		tokens := strings.Fields(rewrite)
+		if err := checkPattern(tokens[0]); err != nil {
+			log.Printf("WARN: Skipping rewrite \"%s\" for app %s: %v.\n", rewrite, appConfig.Name, err)
+			continue
+		}
+		rewriteRules = append(rewriteRules, newRewriteRule(tokens[0], tokens[1]))
+	}
+	return rewriteRules
+}
+
+// checkPattern catches the mistakes in a redirect or rewrite pattern that would keep nginx from
+// loading its configuration: unbalanced parentheses, an unterminated character class, or a
+// trailing backslash.  Patterns are otherwise left for nginx, which evaluates them using PCRE, to
+// interpret; they aren't parsed as Go regular expressions because those lack PCRE features such
+// as lookarounds and backreferences.
+func checkPattern(pattern string) error {
+	depth := 0
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\':
+			if i++; i == len(pattern) {
+				return fmt.Errorf("trailing backslash")
+			}
+		case inClass:
+			// A ] that opens the class, as in []] or [^]], is a member of it.
+			if c == ']' && pattern[i-1] != '[' && !(pattern[i-1] == '^' && pattern[i-2] == '[') {
+				inClass = false
+			}
+		case c == '[':
+			inClass = true
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth--; depth < 0 {
+				return fmt.Errorf("unexpected )")
+			}
+		}
+	}
+	if inClass {
+		return fmt.Errorf("missing closing ]")
+	}
+	if depth > 0 {
+		return fmt.Errorf("missing closing )")
+	}
+	return nil
+}
+
+// buildOriginRegex returns a regular expression matching any of the given origins.  The origin "*"
+// matches any origin at all, while a leading "*." in an origin's host matches one or more
+// subdomains.
+func buildOriginRegex(origins []string) string {
+	patterns := make([]string, len(origins))
+	for i, origin := range origins {
+		if origin == "*" {
+			patterns[i] = ".+"
+			continue
+		}
+		patterns[i] = strings.Replace(regexp.QuoteMeta(origin), `\*\.`, `([a-z0-9-]+\.)+`, 1)
+	}
+	return strings.Join(patterns, "|")
 }
 
-func buildBuilderConfig(service *v1.Service) (*BuilderConfig, error) {
+func buildBuilderConfig(service *v1.Service, routerConfig *RouterConfig) (*BuilderConfig, error) {
 	builderConfig := newBuilderConfig()
 	builderConfig.ServiceIP = service.Spec.ClusterIP
-	err := modeler.MapToModel(service.Annotations, "nginx", builderConfig)
+	err := mapAnnotations(routerConfig, "Service", service.ObjectMeta, "nginx", builderConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -504,6 +1385,65 @@ func buildCertificate(certSecret *v1.Secret, context string) (*Certificate, erro
 	return newCertificate(certStr, keyStr), nil
 }
 
+// buildCacheZones parses the router's cache zone definitions, each of the form
+// "<name> <path> <size> <inactive>".  Definitions reusing a name or path are skipped.
+func buildCacheZones(routerConfig *RouterConfig) []*CacheZone {
+	var cacheZones []*CacheZone
+	names := make(map[string]bool, len(routerConfig.CacheZones))
+	paths := make(map[string]bool, len(routerConfig.CacheZones))
+	for _, cacheZoneStr := range routerConfig.CacheZones {
+		tokens := strings.Fields(cacheZoneStr)
+		if len(tokens) != 4 {
+			log.Printf("WARN: Ignoring malformed cache zone \"%s\".\n", cacheZoneStr)
+			continue
+		}
+		if names[tokens[0]] || paths[tokens[1]] {
+			log.Printf("WARN: Ignoring cache zone \"%s\", which reuses the name or path of another cache zone.\n", cacheZoneStr)
+			continue
+		}
+		names[tokens[0]] = true
+		paths[tokens[1]] = true
+		cacheZones = append(cacheZones, newCacheZone(tokens[0], tokens[1], tokens[2], tokens[3]))
+	}
+	return cacheZones
+}
+
+func hasCacheZone(routerConfig *RouterConfig, name string) bool {
+	for _, cacheZone := range routerConfig.CacheZoneConfigs {
+		if cacheZone.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// buildErrorPages returns the custom error and maintenance pages found in the given config map,
+// keyed by error code or "maintenance".
+func buildErrorPages(configMap *v1.ConfigMap, context string) map[string]string {
+	pages := make(map[string]string, len(errorPageNames))
+	for _, name := range errorPageNames {
+		if page, ok := configMap.Data[fmt.Sprintf("%s.html", name)]; ok {
+			pages[name] = page
+		}
+	}
+	if len(pages) == 0 {
+		log.Printf("WARN: The k8s config map intended to convey the %s error pages contained no recognized entries.\n", context)
+		return nil
+	}
+	return pages
+}
+
+// buildCA returns the CA bundle found in the given secret, or "" if there is none.
+func buildCA(caSecret *v1.Secret, context string) string {
+	ca, ok := caSecret.Data["ca.crt"]
+	// If no CA bundle is found in the secret, warn and return ""
+	if !ok {
+		log.Printf("WARN: The k8s secret intended to convey the %s back end CA contained no entry \"ca.crt\".\n", context)
+		return ""
+	}
+	return string(ca)
+}
+
 func buildDHParam(dhParamSecret *v1.Secret) (string, error) {
 	dhParam, ok := dhParamSecret.Data["dhparam"]
 	// If no dhparam is found in the secret, warn and return ""
@@ -513,3 +1453,24 @@ func buildDHParam(dhParamSecret *v1.Secret) (string, error) {
 	}
 	return string(dhParam), nil
 }
+
+// splitList splits a comma-delimited list, such as one read from the environment, ignoring
+// surrounding whitespace and empty entries.
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
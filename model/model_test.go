@@ -2,8 +2,10 @@ package model
 
 import (
 	"reflect"
+	"regexp"
 	"testing"
 
+	"k8s.io/client-go/1.4/kubernetes/fake"
 	"k8s.io/client-go/1.4/pkg/api/v1"
 	"k8s.io/client-go/1.4/pkg/apis/extensions/v1beta1"
 	"k8s.io/client-go/1.4/pkg/util/intstr"
@@ -111,6 +113,9 @@ func TestBuildRouterConfig(t *testing.T) {
 
 	expectedConfig.PlatformCertificate = platformCert
 
+	// A computed value.
+	expectedConfig.AccessLogConfig.Fields = defaultLogFields
+
 	actualConfig, err := buildRouterConfig(&routerDeployment, &platformCertSecret, &dhParamSecret)
 	if err != nil {
 		t.Error(err)
@@ -166,7 +171,7 @@ func TestBuildBuilderConfig(t *testing.T) {
 		ServiceIP: "1.2.3.4",
 	}
 
-	actualConfig, err := buildBuilderConfig(&builderService)
+	actualConfig, err := buildBuilderConfig(&builderService, &RouterConfig{})
 	if err != nil {
 		t.Error(err)
 	}
@@ -271,3 +276,359 @@ func TestBuildDHParam(t *testing.T) {
 		t.Errorf("Invalid DHParam Secret should have returned empty string.")
 	}
 }
+
+func TestBuildLocations(t *testing.T) {
+	routerConfig, err := newRouterConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	routerConfig.DefaultWhitelist = []string{"1.1.1.1"}
+	appConfig, err := newAppConfig(routerConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appConfig.Whitelist = []string{"2.2.2.2"}
+	appConfig.PathWhitelistMappings = map[string]string{
+		"/ops":   "4.4.4.4",
+		"/admin": "3.3.3.3 10.0.0.0/8",
+	}
+
+	testCases := []struct {
+		whitelistMode     string
+		pathWhitelistMode string
+		adminWhitelist    []string
+	}{
+		{"extend", "extend", []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "10.0.0.0/8"}},
+		{"override", "extend", []string{"2.2.2.2", "3.3.3.3", "10.0.0.0/8"}},
+		{"extend", "override", []string{"3.3.3.3", "10.0.0.0/8"}},
+	}
+	for _, testCase := range testCases {
+		routerConfig.WhitelistMode = testCase.whitelistMode
+		appConfig.PathWhitelistMode = testCase.pathWhitelistMode
+		locations := buildLocations(appConfig, routerConfig)
+		// The root location always comes first and locations are otherwise ordered by path.
+		if len(locations) != 3 || locations[0].Path != "/" || locations[1].Path != "/admin" || locations[2].Path != "/ops" {
+			t.Fatalf("Unexpected locations: %+v", locations)
+		}
+		if locations[0].Whitelist != nil {
+			t.Errorf("Expected the root location to inherit the app whitelist, but got %v.", locations[0].Whitelist)
+		}
+		if !reflect.DeepEqual(testCase.adminWhitelist, locations[1].Whitelist) {
+			t.Errorf("Using modes %s/%s, expected whitelist %v, but got %v.", testCase.whitelistMode, testCase.pathWhitelistMode, testCase.adminWhitelist, locations[1].Whitelist)
+		}
+	}
+}
+
+func TestBuildHeadersConfig(t *testing.T) {
+	routerConfig, err := newRouterConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	routerConfig.HeadersConfig = &HeadersConfig{
+		SetResponse:  map[string]string{"X-Frame-Options": "DENY"},
+		HideResponse: []string{"X-Powered-By"},
+	}
+	appConfig, err := newAppConfig(routerConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appConfig.HeadersConfig = &HeadersConfig{
+		SetRequest:   map[string]string{"host": "example.com", "X-Tenant": "acme"},
+		SetResponse:  map[string]string{"x-frame-options": "SAMEORIGIN"},
+		HideResponse: []string{"x-powered-by", "Server"},
+	}
+
+	// In extend mode, the app's headers are combined with the defaults; app values win and
+	// router-managed request headers are dropped.
+	expected := &HeadersConfig{
+		SetRequest:   map[string]string{"X-Tenant": "acme"},
+		SetResponse:  map[string]string{"X-Frame-Options": "SAMEORIGIN"},
+		HideResponse: []string{"X-Powered-By", "Server"},
+	}
+	actual := buildHeadersConfig(appConfig, routerConfig)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %+v, but got %+v", expected, actual)
+	}
+
+	// In override mode, the defaults are ignored entirely.
+	appConfig.HeadersMode = "override"
+	appConfig.HeadersConfig = &HeadersConfig{
+		HideResponse: []string{"Server"},
+	}
+	expected = &HeadersConfig{
+		HideResponse: []string{"Server"},
+	}
+	actual = buildHeadersConfig(appConfig, routerConfig)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %+v, but got %+v", expected, actual)
+	}
+}
+
+func TestBuildOriginRegex(t *testing.T) {
+	originRegex := regexp.MustCompile("(?i)^(" + buildOriginRegex([]string{"https://example.com", "https://*.example.org"}) + ")$")
+	for _, origin := range []string{"https://example.com", "https://foo.example.org", "https://foo.bar.example.org"} {
+		if !originRegex.MatchString(origin) {
+			t.Errorf("Expected origin %s to be allowed.", origin)
+		}
+	}
+	for _, origin := range []string{"http://example.com", "https://example.org", "https://fooexample.com", "https://evil.com/https://example.com"} {
+		if originRegex.MatchString(origin) {
+			t.Errorf("Expected origin %s not to be allowed.", origin)
+		}
+	}
+	anyRegex := regexp.MustCompile("(?i)^(" + buildOriginRegex([]string{"*"}) + ")$")
+	if !anyRegex.MatchString("https://anything.example.net") {
+		t.Errorf("Expected the origin \"*\" to allow any origin.")
+	}
+}
+
+func TestBuildRedirectAndRewriteRules(t *testing.T) {
+	appConfig := &AppConfig{
+		Name:      "foo",
+		Redirects: []string{"^https?://www\\.example\\.com(/.*)$ https://example.com$1 301", "^/old/(.*)$ /new/$1 308", "^/bad/(.*$ /good 302", "^/(?!api/)(.*)$ /app/$1 302"},
+		Rewrites:  []string{"^/api/v1/(.*)$ /$1", "^/bad/(.*$ /good", "^/(\\w+)/\\1$ /$1"},
+	}
+	// Patterns using PCRE features unknown to Go, like lookarounds and backreferences, are kept.
+	expectedRedirects := []*RedirectRule{
+		{Source: "^https?://www\\.example\\.com(/.*)$", Target: "https://example.com$1", Status: 301, MatchURL: true},
+		{Source: "^/old/(.*)$", Target: "/new/$1", Status: 308, MatchURL: false},
+		{Source: "^/(?!api/)(.*)$", Target: "/app/$1", Status: 302, MatchURL: false},
+	}
+	actualRedirects := buildRedirectRules(appConfig)
+	if !reflect.DeepEqual(expectedRedirects, actualRedirects) {
+		t.Errorf("Expected redirects %+v, but got %+v", expectedRedirects, actualRedirects)
+	}
+	expectedRewrites := []*RewriteRule{
+		{Source: "^/api/v1/(.*)$", Target: "/$1"},
+		{Source: "^/(\\w+)/\\1$", Target: "/$1"},
+	}
+	actualRewrites := buildRewriteRules(appConfig)
+	if !reflect.DeepEqual(expectedRewrites, actualRewrites) {
+		t.Errorf("Expected rewrites %+v, but got %+v", expectedRewrites, actualRewrites)
+	}
+}
+
+func TestCheckPattern(t *testing.T) {
+	for _, pattern := range []string{"^/a/(.*)$", "^/(?<=a)b", `^/(\w+)/\1$`, "^/[()]+$", "^/[]a]$", "^/[^]a]$", `^/\(`, "^/a{1;2}"} {
+		if err := checkPattern(pattern); err != nil {
+			t.Errorf("Expected pattern %s to be accepted, but got %v", pattern, err)
+		}
+	}
+	for _, pattern := range []string{"^/a/(.*$", "^/a)$", "^/[a-z$", `^/a\`} {
+		if err := checkPattern(pattern); err == nil {
+			t.Errorf("Expected pattern %s to be rejected, but it was accepted", pattern)
+		}
+	}
+}
+
+func TestBuildErrorPages(t *testing.T) {
+	configMap := &v1.ConfigMap{
+		Data: map[string]string{
+			"maintenance.html": "<h1>Back soon</h1>",
+			"404.html":         "<h1>Not found</h1>",
+			"418.html":         "<h1>I'm a teapot</h1>",
+		},
+	}
+	expectedPages := map[string]string{
+		"maintenance": "<h1>Back soon</h1>",
+		"404":         "<h1>Not found</h1>",
+	}
+	actualPages := buildErrorPages(configMap, "foo")
+	if !reflect.DeepEqual(expectedPages, actualPages) {
+		t.Errorf("Expected pages %+v, but got %+v", expectedPages, actualPages)
+	}
+	// A config map with no recognized entries yields no pages.
+	configMap = &v1.ConfigMap{Data: map[string]string{"index.html": "<h1>Hello</h1>"}}
+	if actualPages := buildErrorPages(configMap, "foo"); actualPages != nil {
+		t.Errorf("Expected no pages, but got %+v", actualPages)
+	}
+}
+
+func TestBuildCacheZones(t *testing.T) {
+	routerConfig := &RouterConfig{
+		CacheZones: []string{
+			"api /opt/router/cache/api 100m 60m",
+			"static /opt/router/cache/static 1g 1d",
+			"api /opt/router/cache/other 100m 60m",
+			"other /opt/router/cache/static 100m 60m",
+		},
+	}
+	expectedCacheZones := []*CacheZone{
+		{Name: "api", Path: "/opt/router/cache/api", Size: "100m", Inactive: "60m"},
+		{Name: "static", Path: "/opt/router/cache/static", Size: "1g", Inactive: "1d"},
+	}
+	actualCacheZones := buildCacheZones(routerConfig)
+	if !reflect.DeepEqual(expectedCacheZones, actualCacheZones) {
+		t.Errorf("Expected cache zones %+v, but got %+v", expectedCacheZones, actualCacheZones)
+	}
+}
+
+func TestBuildUpstreamServers(t *testing.T) {
+	appConfig := &AppConfig{
+		Name:        "foo",
+		ServiceIP:   "1.2.3.4",
+		BackendPort: 80,
+		Nginx:       &NginxAppConfig{RetryConfig: &RetryConfig{Conditions: []string{"error", "timeout"}, Tries: 3}},
+	}
+	expectedUpstreamServers := []string{"1.2.3.4:80", "1.2.3.4:80", "1.2.3.4:80"}
+	actualUpstreamServers := buildUpstreamServers(appConfig)
+	if !reflect.DeepEqual(expectedUpstreamServers, actualUpstreamServers) {
+		t.Errorf("Expected upstream servers %v, but got %v", expectedUpstreamServers, actualUpstreamServers)
+	}
+	// When retries are off, the service IP is only listed once, whatever the number of tries.
+	appConfig.Nginx.RetryConfig.Conditions = []string{"off"}
+	expectedUpstreamServers = []string{"1.2.3.4:80"}
+	actualUpstreamServers = buildUpstreamServers(appConfig)
+	if !reflect.DeepEqual(expectedUpstreamServers, actualUpstreamServers) {
+		t.Errorf("Expected upstream servers %v, but got %v", expectedUpstreamServers, actualUpstreamServers)
+	}
+}
+
+func TestBuildUpstreamServersBackendPort(t *testing.T) {
+	appConfig := &AppConfig{
+		Name:        "foo",
+		ServiceIP:   "1.2.3.4",
+		BackendPort: 8443,
+		Nginx:       &NginxAppConfig{RetryConfig: &RetryConfig{Conditions: []string{"error", "timeout"}, Tries: 1}},
+	}
+	expectedUpstreamServers := []string{"1.2.3.4:8443"}
+	actualUpstreamServers := buildUpstreamServers(appConfig)
+	if !reflect.DeepEqual(expectedUpstreamServers, actualUpstreamServers) {
+		t.Errorf("Expected upstream servers %v, but got %v", expectedUpstreamServers, actualUpstreamServers)
+	}
+}
+
+func TestBuildCA(t *testing.T) {
+	caSecret := &v1.Secret{Data: map[string][]byte{"ca.crt": []byte("bizbaz")}}
+	if actualCA := buildCA(caSecret, "foo"); actualCA != "bizbaz" {
+		t.Errorf("Expected CA bizbaz, but got %s", actualCA)
+	}
+	caSecret = &v1.Secret{Data: map[string][]byte{"tls.crt": []byte("bizbaz")}}
+	if actualCA := buildCA(caSecret, "foo"); actualCA != "" {
+		t.Errorf("Expected no CA, but got %s", actualCA)
+	}
+}
+
+func TestFilterServicesByClass(t *testing.T) {
+	services := &v1.ServiceList{
+		Items: []v1.Service{
+			{ObjectMeta: v1.ObjectMeta{Name: "foo"}},
+			{ObjectMeta: v1.ObjectMeta{Name: "bar", Annotations: map[string]string{"router.deis.io/class": "internal"}}},
+			{ObjectMeta: v1.ObjectMeta{Name: "baz", Annotations: map[string]string{"router.deis.io/class": "external"}}},
+			{ObjectMeta: v1.ObjectMeta{Name: "qux", Annotations: map[string]string{"router.deis.io/class": ""}}},
+		},
+	}
+	testCases := []struct {
+		class         string
+		expectedNames []string
+	}{
+		{"", []string{"foo", "qux"}},
+		{"internal", []string{"bar"}},
+		{"other", nil},
+	}
+	for _, testCase := range testCases {
+		var actualNames []string
+		for _, service := range filterServicesByClass(services, testCase.class).Items {
+			actualNames = append(actualNames, service.Name)
+		}
+		if !reflect.DeepEqual(testCase.expectedNames, actualNames) {
+			t.Errorf("Expected services %v for class \"%s\", but got %v", testCase.expectedNames, testCase.class, actualNames)
+		}
+	}
+}
+
+func TestScopeNamespaces(t *testing.T) {
+	testCases := []struct {
+		candidates []string
+		allowed    []string
+		excluded   []string
+		expected   []string
+	}{
+		{[]string{"foo", "bar", "baz"}, nil, nil, []string{"foo", "bar", "baz"}},
+		{[]string{"foo", "bar", "baz"}, []string{"bar", "qux"}, nil, []string{"bar"}},
+		{[]string{"foo", "bar", "baz"}, nil, []string{"baz"}, []string{"foo", "bar"}},
+		{[]string{"foo", "bar", "baz"}, []string{"foo", "baz"}, []string{"baz"}, []string{"foo"}},
+		{[]string{"foo"}, nil, []string{"foo"}, []string{}},
+	}
+	for _, testCase := range testCases {
+		actual := scopeNamespaces(testCase.candidates, testCase.allowed, testCase.excluded)
+		if !reflect.DeepEqual(testCase.expected, actual) {
+			t.Errorf("Expected namespaces %v, but got %v", testCase.expected, actual)
+		}
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	expected := []string{"foo", "bar", "baz"}
+	if actual := splitList(" foo, bar,,baz ,"); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, but got %v", expected, actual)
+	}
+	if actual := splitList(""); len(actual) != 0 {
+		t.Errorf("Expected an empty list, but got %v", actual)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	routable := map[string]string{"router.deis.io/routable": "true"}
+	kubeClient := fake.NewSimpleClientset(
+		&v1beta1.Deployment{ObjectMeta: v1.ObjectMeta{Name: routerName, Namespace: namespace}},
+		&v1.Service{
+			ObjectMeta: v1.ObjectMeta{Name: "foo", Namespace: "foo", Labels: routable, Annotations: map[string]string{"router.deis.io/domains": "foo"}},
+			Spec:       v1.ServiceSpec{ClusterIP: "10.0.0.1"},
+		},
+		&v1.Endpoints{
+			ObjectMeta: v1.ObjectMeta{Name: "foo", Namespace: "foo"},
+			Subsets:    []v1.EndpointSubset{{Addresses: []v1.EndpointAddress{{IP: "172.17.0.2"}}}},
+		},
+		// Without an endpoints object, bar is routed to but unavailable.
+		&v1.Service{
+			ObjectMeta: v1.ObjectMeta{Name: "bar", Namespace: "bar", Labels: routable, Annotations: map[string]string{"router.deis.io/domains": "bar"}},
+			Spec:       v1.ServiceSpec{ClusterIP: "10.0.0.2"},
+		},
+		// Services that aren't routable are ignored.
+		&v1.Service{
+			ObjectMeta: v1.ObjectMeta{Name: "baz", Namespace: "baz", Annotations: map[string]string{"router.deis.io/domains": "baz"}},
+			Spec:       v1.ServiceSpec{ClusterIP: "10.0.0.3"},
+		},
+	)
+
+	routerConfig, err := Build(kubeClient)
+	if err != nil {
+		t.Fatalf("Encountered an error: %v", err)
+	}
+	if len(routerConfig.AppConfigs) != 2 {
+		t.Fatalf("Expected 2 apps, but got %d", len(routerConfig.AppConfigs))
+	}
+	expected := map[string]bool{"foo": true, "bar": false}
+	for _, appConfig := range routerConfig.AppConfigs {
+		available, ok := expected[appConfig.Name]
+		if !ok {
+			t.Errorf("Unexpected app %s", appConfig.Name)
+			continue
+		}
+		if appConfig.Available != available {
+			t.Errorf("Expected app %s to be available: %t, but got %t", appConfig.Name, available, appConfig.Available)
+		}
+	}
+
+	// Without the router's own deployment, there's nothing to build.
+	if _, err := Build(fake.NewSimpleClientset()); err == nil {
+		t.Error("Expected an error building without the router's deployment, but got none")
+	}
+
+	// Invalid annotation values are skipped unless validation is strict.
+	invalidDeployment := &v1beta1.Deployment{ObjectMeta: v1.ObjectMeta{Name: routerName, Namespace: namespace, Annotations: map[string]string{"router.deis.io/nginx.workerProcesses": "foobar"}}}
+	routerConfig, err = Build(fake.NewSimpleClientset(invalidDeployment))
+	if err != nil {
+		t.Fatalf("Expected invalid annotation values to be skipped, but got %v", err)
+	}
+	expectedRejections := []*RejectedAnnotation{{Kind: "Deployment", Namespace: namespace, Name: routerName, Key: "router.deis.io/nginx.workerProcesses", Value: "foobar"}}
+	if !reflect.DeepEqual(expectedRejections, routerConfig.RejectedAnnotations) {
+		t.Errorf("Expected rejected annotations %v, but got %v", expectedRejections, routerConfig.RejectedAnnotations)
+	}
+	SetStrictValidation(true)
+	defer SetStrictValidation(false)
+	if _, err := Build(fake.NewSimpleClientset(invalidDeployment)); err == nil {
+		t.Error("Expected an error building with an invalid annotation value, but got none")
+	}
+}
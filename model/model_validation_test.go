@@ -135,6 +135,14 @@ func TestValidWhitelistMode(t *testing.T) {
 	testValidValues(t, newTestRouterConfig, "WhitelistMode", "whitelistMode", []string{"extend", "override"})
 }
 
+func TestInvalidDefaultBlacklist(t *testing.T) {
+	testInvalidValues(t, newTestRouterConfig, "DefaultBlacklist", "defaultBlacklist", []string{"0", "-1", "foobar"})
+}
+
+func TestValidDefaultBlacklist(t *testing.T) {
+	testValidValues(t, newTestRouterConfig, "DefaultBlacklist", "defaultBlacklist", []string{"1.2.3.4", "0.0.0.0/0", "1.2.3.4,0.0.0.0/0", "1.2.3.4, 0.0.0.0/0"})
+}
+
 func TestValidHTTP2Enabled(t *testing.T) {
 	testValidValues(t, newTestRouterConfig, "HttpEnabled", "http2Enabled", []string{"true", "false", "TRUE", "FALSE"})
 }
@@ -215,6 +223,70 @@ func TestValidAppWhitelist(t *testing.T) {
 	testValidValues(t, newTestAppConfig, "Whitelist", "whitelist", []string{"1.2.3.4", "0.0.0.0/0", "1.2.3.4,0.0.0.0/0", "1.2.3.4, 0.0.0.0/0"})
 }
 
+func TestInvalidAppBlacklist(t *testing.T) {
+	testInvalidValues(t, newTestAppConfig, "Blacklist", "blacklist", []string{"0", "-1", "foobar"})
+}
+
+func TestValidAppBlacklist(t *testing.T) {
+	testValidValues(t, newTestAppConfig, "Blacklist", "blacklist", []string{"1.2.3.4", "0.0.0.0/0", "1.2.3.4,0.0.0.0/0", "1.2.3.4, 0.0.0.0/0"})
+}
+
+func TestInvalidAppCountryWhitelist(t *testing.T) {
+	testInvalidValues(t, newTestAppConfig, "CountryWhitelist", "countryWhitelist", []string{"0", "-1", "USA", "U", "US;CA"})
+}
+
+func TestValidAppCountryWhitelist(t *testing.T) {
+	testValidValues(t, newTestAppConfig, "CountryWhitelist", "countryWhitelist", []string{"US", "us", "US,CA", "US, CA, GB"})
+}
+
+func TestInvalidAppCountryBlacklist(t *testing.T) {
+	testInvalidValues(t, newTestAppConfig, "CountryBlacklist", "countryBlacklist", []string{"0", "-1", "USA", "U", "US;CA"})
+}
+
+func TestValidAppCountryBlacklist(t *testing.T) {
+	testValidValues(t, newTestAppConfig, "CountryBlacklist", "countryBlacklist", []string{"US", "us", "US,CA", "US, CA, GB"})
+}
+
+func TestInvalidAppPathWhitelists(t *testing.T) {
+	testInvalidValues(t, newTestAppConfig, "PathWhitelistMappings", "pathWhitelists", []string{"0", "foobar", "/admin", "admin:1.2.3.4", "/admin:foobar", "/admin:1.2.3.4,1.2.3.5", "/ad min:1.2.3.4"})
+}
+
+func TestValidAppPathWhitelists(t *testing.T) {
+	testValidValues(t, newTestAppConfig, "PathWhitelistMappings", "pathWhitelists", []string{"/admin:1.2.3.4", "/admin/:10.0.0.0/8 192.168.0.0/16", "/admin:1.2.3.4,/ops:0.0.0.0/0", "/admin:1.2.3.4, /api/v1/internal:10.0.0.0/8  172.16.0.0/12"})
+}
+
+func TestInvalidAppPathWhitelistMode(t *testing.T) {
+	testInvalidValues(t, newTestAppConfig, "PathWhitelistMode", "pathWhitelistMode", []string{"0", "-1", "foobar"})
+}
+
+func TestValidAppPathWhitelistMode(t *testing.T) {
+	testValidValues(t, newTestAppConfig, "PathWhitelistMode", "pathWhitelistMode", []string{"extend", "override"})
+}
+
+func TestInvalidAppHeadersMode(t *testing.T) {
+	testInvalidValues(t, newTestAppConfig, "HeadersMode", "headersMode", []string{"0", "-1", "foobar"})
+}
+
+func TestValidAppHeadersMode(t *testing.T) {
+	testValidValues(t, newTestAppConfig, "HeadersMode", "headersMode", []string{"extend", "override"})
+}
+
+func TestInvalidAppRedirects(t *testing.T) {
+	testInvalidValues(t, newTestAppConfig, "Redirects", "redirects", []string{"foobar", "^/old /new", "^/old /new 303", "^/old\\ /new 301", "^/old \"/new\" 301", "^/a{1,2} /b 301"})
+}
+
+func TestValidAppRedirects(t *testing.T) {
+	testValidValues(t, newTestAppConfig, "Redirects", "redirects", []string{"^/old/(.*)$ /new/$1 301", "^https?://www\\.example\\.com(/.*)$ https://example.com$1 308", "^http://([^/]+)(/checkout.*)$ https://$1$2 302, ^/a /b 307"})
+}
+
+func TestInvalidAppRewrites(t *testing.T) {
+	testInvalidValues(t, newTestAppConfig, "Rewrites", "rewrites", []string{"foobar", "^/a /b /c", "^/a\\ /b", "^/a \"/b\""})
+}
+
+func TestValidAppRewrites(t *testing.T) {
+	testValidValues(t, newTestAppConfig, "Rewrites", "rewrites", []string{"^/api/v1/(.*)$ /$1", "^/a /b, ^/c /d"})
+}
+
 func TestInvalidAppConnectTimeout(t *testing.T) {
 	testInvalidValues(t, newTestAppConfig, "ConnectTimeout", "connectTimeout", []string{"0", "-1", "foobar"})
 }
@@ -375,6 +447,526 @@ func TestValidProxyBusyBuffersBusySize(t *testing.T) {
 	testValidValues(t, newTestProxyBuffersConfig, "BusySize", "busySize", []string{"1", "2", "20", "1k", "2k", "10m", "10M"})
 }
 
+func TestInvalidHeadersSetRequest(t *testing.T) {
+	testInvalidValues(t, newTestHeadersConfig, "SetRequest", "setRequest", []string{"foobar", "X Foo:bar", "X-Foo:", "X-Foo:\"bar\"", "X-Foo:bar\\"})
+}
+
+func TestValidHeadersSetRequest(t *testing.T) {
+	testValidValues(t, newTestHeadersConfig, "SetRequest", "setRequest", []string{"X-Foo:bar", "X-Foo:bar,X-Bar:$request_id", "X-Foo: bar baz, X-Bar: https://example.com"})
+}
+
+func TestInvalidHeadersHideRequest(t *testing.T) {
+	testInvalidValues(t, newTestHeadersConfig, "HideRequest", "hideRequest", []string{"X Foo", "X-Foo:bar", "X-Foo;"})
+}
+
+func TestValidHeadersHideRequest(t *testing.T) {
+	testValidValues(t, newTestHeadersConfig, "HideRequest", "hideRequest", []string{"Cookie", "Cookie,X-Foo", "Cookie, X-Foo"})
+}
+
+func TestInvalidHeadersAddResponse(t *testing.T) {
+	testInvalidValues(t, newTestHeadersConfig, "AddResponse", "addResponse", []string{"foobar", "X Foo:bar", "X-Foo:", "X-Foo:\"bar\""})
+}
+
+func TestValidHeadersAddResponse(t *testing.T) {
+	testValidValues(t, newTestHeadersConfig, "AddResponse", "addResponse", []string{"Referrer-Policy:no-referrer", "Content-Security-Policy:default-src 'self' https:; img-src *"})
+}
+
+func TestInvalidHeadersSetResponse(t *testing.T) {
+	testInvalidValues(t, newTestHeadersConfig, "SetResponse", "setResponse", []string{"foobar", "X Foo:bar", "X-Foo:", "X-Foo:\"bar\""})
+}
+
+func TestValidHeadersSetResponse(t *testing.T) {
+	testValidValues(t, newTestHeadersConfig, "SetResponse", "setResponse", []string{"X-Frame-Options:DENY", "X-Frame-Options:DENY,X-Content-Type-Options:nosniff"})
+}
+
+func TestInvalidHeadersHideResponse(t *testing.T) {
+	testInvalidValues(t, newTestHeadersConfig, "HideResponse", "hideResponse", []string{"X Powered By", "X-Powered-By:PHP"})
+}
+
+func TestValidHeadersHideResponse(t *testing.T) {
+	testValidValues(t, newTestHeadersConfig, "HideResponse", "hideResponse", []string{"X-Powered-By", "X-Powered-By,Server"})
+}
+
+func TestInvalidCORSEnabled(t *testing.T) {
+	testInvalidValues(t, newTestCORSConfig, "Enabled", "enabled", []string{"0", "-1", "foobar"})
+}
+
+func TestValidCORSEnabled(t *testing.T) {
+	testValidValues(t, newTestCORSConfig, "Enabled", "enabled", []string{"true", "false", "TRUE", "FALSE"})
+}
+
+func TestInvalidCORSAllowOrigins(t *testing.T) {
+	testInvalidValues(t, newTestCORSConfig, "AllowOrigins", "allowOrigins", []string{"foobar", "example.com", "ftp://example.com", "https://example.com/", "https://foo.*.example.com", "https://example.com:0"})
+}
+
+func TestValidCORSAllowOrigins(t *testing.T) {
+	testValidValues(t, newTestCORSConfig, "AllowOrigins", "allowOrigins", []string{"*", "https://example.com", "http://localhost:3000", "https://*.example.com", "https://example.com, https://*.example.org"})
+}
+
+func TestInvalidCORSAllowMethods(t *testing.T) {
+	testInvalidValues(t, newTestCORSConfig, "AllowMethods", "allowMethods", []string{"0", "get", "FOO", "GET;POST"})
+}
+
+func TestValidCORSAllowMethods(t *testing.T) {
+	testValidValues(t, newTestCORSConfig, "AllowMethods", "allowMethods", []string{"GET", "GET,POST", "GET, POST, DELETE"})
+}
+
+func TestInvalidCORSAllowHeaders(t *testing.T) {
+	testInvalidValues(t, newTestCORSConfig, "AllowHeaders", "allowHeaders", []string{"X Foo", "X-Foo:bar"})
+}
+
+func TestValidCORSAllowHeaders(t *testing.T) {
+	testValidValues(t, newTestCORSConfig, "AllowHeaders", "allowHeaders", []string{"Authorization", "Authorization, Content-Type"})
+}
+
+func TestInvalidCORSExposeHeaders(t *testing.T) {
+	testInvalidValues(t, newTestCORSConfig, "ExposeHeaders", "exposeHeaders", []string{"X Foo", "X-Foo:bar"})
+}
+
+func TestValidCORSExposeHeaders(t *testing.T) {
+	testValidValues(t, newTestCORSConfig, "ExposeHeaders", "exposeHeaders", []string{"X-Total-Count", "X-Total-Count,Link"})
+}
+
+func TestInvalidCORSAllowCredentials(t *testing.T) {
+	testInvalidValues(t, newTestCORSConfig, "AllowCredentials", "allowCredentials", []string{"0", "-1", "foobar"})
+}
+
+func TestValidCORSAllowCredentials(t *testing.T) {
+	testValidValues(t, newTestCORSConfig, "AllowCredentials", "allowCredentials", []string{"true", "false", "TRUE", "FALSE"})
+}
+
+func TestInvalidCORSMaxAge(t *testing.T) {
+	testInvalidValues(t, newTestCORSConfig, "MaxAge", "maxAge", []string{"-1", "foobar", "10s"})
+}
+
+func TestValidCORSMaxAge(t *testing.T) {
+	testValidValues(t, newTestCORSConfig, "MaxAge", "maxAge", []string{"0", "600", "86400"})
+}
+
+func TestInvalidGeoIPEnabled(t *testing.T) {
+	testInvalidValues(t, newTestGeoIPConfig, "Enabled", "enabled", []string{"0", "-1", "foobar"})
+}
+
+func TestValidGeoIPEnabled(t *testing.T) {
+	testValidValues(t, newTestGeoIPConfig, "Enabled", "enabled", []string{"true", "false", "TRUE", "FALSE"})
+}
+
+func TestInvalidGeoIPCountryDatabase(t *testing.T) {
+	testInvalidValues(t, newTestGeoIPConfig, "CountryDatabase", "countryDatabase", []string{"foobar", "GeoIP.dat", "/foo bar/GeoIP.dat", "/GeoIP.dat;"})
+}
+
+func TestValidGeoIPCountryDatabase(t *testing.T) {
+	testValidValues(t, newTestGeoIPConfig, "CountryDatabase", "countryDatabase", []string{"/GeoIP.dat", "/opt/router/geoip/GeoIP.dat", "/var/lib/geoip/country.dat"})
+}
+
+func TestInvalidLogFormat(t *testing.T) {
+	testInvalidValues(t, newTestRouterConfig, "LogFormat", "logFormat", []string{"$remote_addr '$status'", "$remote_addr \\", "$request';"})
+}
+
+func TestValidLogFormat(t *testing.T) {
+	testValidValues(t, newTestRouterConfig, "LogFormat", "logFormat", []string{"$remote_addr - $status", `[$time_iso8601] - "$request" - $request_time`})
+}
+
+func TestInvalidAccessLogFormat(t *testing.T) {
+	testInvalidValues(t, newTestAccessLogConfig, "Format", "format", []string{"JSON", "xml", "foobar"})
+}
+
+func TestValidAccessLogFormat(t *testing.T) {
+	testValidValues(t, newTestAccessLogConfig, "Format", "format", []string{"text", "json"})
+}
+
+func TestInvalidAccessLogFieldSet(t *testing.T) {
+	testInvalidValues(t, newTestAccessLogConfig, "FieldSet", "fieldSet", []string{"all", "Default", "foobar"})
+}
+
+func TestValidAccessLogFieldSet(t *testing.T) {
+	testValidValues(t, newTestAccessLogConfig, "FieldSet", "fieldSet", []string{"default", "extended", "custom"})
+}
+
+func TestInvalidAccessLogFields(t *testing.T) {
+	testInvalidValues(t, newTestAccessLogConfig, "CustomFields", "fields", []string{"$status", "status,", "remote_addr;status", "request-time"})
+}
+
+func TestValidAccessLogFields(t *testing.T) {
+	testValidValues(t, newTestAccessLogConfig, "CustomFields", "fields", []string{"status", "remote_addr,status", "remote_addr, status, request_time"})
+}
+
+func TestInvalidLogForwardingSinks(t *testing.T) {
+	testInvalidValues(t, newTestLogForwardingConfig, "Sinks", "sinks", []string{"stderr", "stdout,", "stdout;syslog", "HTTP"})
+}
+
+func TestValidLogForwardingSinks(t *testing.T) {
+	testValidValues(t, newTestLogForwardingConfig, "Sinks", "sinks", []string{"stdout", "syslog,http", "stdout, syslog, http"})
+}
+
+func TestInvalidLogForwardingSyslogAddress(t *testing.T) {
+	testInvalidValues(t, newTestLogForwardingConfig, "SyslogAddress", "syslogAddress", []string{"syslog.example.com:514", "unix:///dev/log", "udp://syslog.example.com", "tcp://syslog.example.com:0"})
+}
+
+func TestValidLogForwardingSyslogAddress(t *testing.T) {
+	testValidValues(t, newTestLogForwardingConfig, "SyslogAddress", "syslogAddress", []string{"udp://syslog.example.com:514", "tcp://10.0.0.1:6514"})
+}
+
+func TestInvalidLogForwardingHTTPURL(t *testing.T) {
+	testInvalidValues(t, newTestLogForwardingConfig, "HTTPURL", "httpURL", []string{"collector.example.com", "ftp://collector.example.com", "http://collector example.com"})
+}
+
+func TestValidLogForwardingHTTPURL(t *testing.T) {
+	testValidValues(t, newTestLogForwardingConfig, "HTTPURL", "httpURL", []string{"http://collector.example.com", "https://collector.example.com:8443/logs?source=router"})
+}
+
+func TestInvalidLogForwardingBufferSize(t *testing.T) {
+	testInvalidValues(t, newTestLogForwardingConfig, "BufferSize", "bufferSize", []string{"0", "-1", "foobar"})
+}
+
+func TestValidLogForwardingBufferSize(t *testing.T) {
+	testValidValues(t, newTestLogForwardingConfig, "BufferSize", "bufferSize", []string{"1", "10000"})
+}
+
+func TestInvalidLogForwardingDropPolicy(t *testing.T) {
+	testInvalidValues(t, newTestLogForwardingConfig, "DropPolicy", "dropPolicy", []string{"none", "Newest", "foobar"})
+}
+
+func TestValidLogForwardingDropPolicy(t *testing.T) {
+	testValidValues(t, newTestLogForwardingConfig, "DropPolicy", "dropPolicy", []string{"newest", "oldest"})
+}
+
+func TestInvalidLogSampleRate(t *testing.T) {
+	testInvalidValues(t, newTestAppConfig, "LogSampleRate", "logSampleRate", []string{"-0.5", "1.5", "2", ".5", "50%"})
+}
+
+func TestValidLogSampleRate(t *testing.T) {
+	testValidValues(t, newTestAppConfig, "LogSampleRate", "logSampleRate", []string{"0", "0.01", "0.5", "1", "1.0"})
+}
+
+func TestInvalidDomainPriority(t *testing.T) {
+	testInvalidValues(t, newTestAppConfig, "DomainPriority", "domainPriority", []string{"high", "1.5", "01", "-0", "+1"})
+}
+
+func TestValidDomainPriority(t *testing.T) {
+	testValidValues(t, newTestAppConfig, "DomainPriority", "domainPriority", []string{"0", "1", "10", "-1", "-100"})
+}
+
+func TestInvalidErrorPagesConfigMap(t *testing.T) {
+	testInvalidValues(t, newTestErrorPagesConfig, "ConfigMap", "configMap", []string{"Foo", "foo_bar", "-foo", "foo/bar"})
+}
+
+func TestValidErrorPagesConfigMap(t *testing.T) {
+	testValidValues(t, newTestErrorPagesConfig, "ConfigMap", "configMap", []string{"foo", "error-pages", "foo.bar"})
+}
+
+func TestInvalidErrorPagesInterceptErrors(t *testing.T) {
+	testInvalidValues(t, newTestErrorPagesConfig, "InterceptErrors", "interceptErrors", []string{"0", "-1", "foobar"})
+}
+
+func TestValidErrorPagesInterceptErrors(t *testing.T) {
+	testValidValues(t, newTestErrorPagesConfig, "InterceptErrors", "interceptErrors", []string{"true", "false", "TRUE", "FALSE"})
+}
+
+func TestInvalidMaintenanceStart(t *testing.T) {
+	testInvalidValues(t, newTestMaintenanceConfig, "Start", "start", []string{"foobar", "2017-01-01", "2017-01-01 02:00:00", "2017-01-01T02:00:00"})
+}
+
+func TestValidMaintenanceStart(t *testing.T) {
+	testValidValues(t, newTestMaintenanceConfig, "Start", "start", []string{"2017-01-01T02:00:00Z", "2017-01-01T02:00:00-05:00", "2017-01-01T02:00:00.5+01:00"})
+}
+
+func TestInvalidMaintenanceEnd(t *testing.T) {
+	testInvalidValues(t, newTestMaintenanceConfig, "End", "end", []string{"foobar", "2017-01-01", "2017-01-01 04:00:00", "2017-01-01T04:00:00"})
+}
+
+func TestValidMaintenanceEnd(t *testing.T) {
+	testValidValues(t, newTestMaintenanceConfig, "End", "end", []string{"2017-01-01T04:00:00Z", "2017-01-01T04:00:00-05:00"})
+}
+
+func TestInvalidMaintenanceSchedule(t *testing.T) {
+	testInvalidValues(t, newTestMaintenanceConfig, "Schedule", "schedule", []string{"foobar", "0 2 * *", "0 2 * * * *", "@daily", "0 2 * * SUN"})
+}
+
+func TestValidMaintenanceSchedule(t *testing.T) {
+	testValidValues(t, newTestMaintenanceConfig, "Schedule", "schedule", []string{"0 2 * * *", "30 1 * * 0", "*/15 0-5 1,15 * 1-5"})
+}
+
+func TestInvalidMaintenanceDuration(t *testing.T) {
+	testInvalidValues(t, newTestMaintenanceConfig, "Duration", "duration", []string{"foobar", "2", "30s", "1.5h", "-1h"})
+}
+
+func TestValidMaintenanceDuration(t *testing.T) {
+	testValidValues(t, newTestMaintenanceConfig, "Duration", "duration", []string{"2h", "90m", "1h30m"})
+}
+
+func TestInvalidMaintenanceBypassWhitelist(t *testing.T) {
+	testInvalidValues(t, newTestMaintenanceConfig, "BypassWhitelist", "bypassWhitelist", []string{"0", "-1", "foobar", "10.0.0.0/33"})
+}
+
+func TestValidMaintenanceBypassWhitelist(t *testing.T) {
+	testValidValues(t, newTestMaintenanceConfig, "BypassWhitelist", "bypassWhitelist", []string{"1.2.3.4", "0.0.0.0/0", "1.2.3.4,10.0.0.0/8"})
+}
+
+func TestInvalidCacheZones(t *testing.T) {
+	testInvalidValues(t, newTestRouterConfig, "CacheZones", "cacheZones", []string{"foobar", "api /opt/router/cache/api 100m", "api cache/api 100m 60m", "API /opt/router/cache/api 100m 60m", "api /opt/router/cache/api 100x 60m", "api /opt/router/cache/api 100m 60m static /opt/router/cache/static 1g 1d"})
+}
+
+func TestValidCacheZones(t *testing.T) {
+	testValidValues(t, newTestRouterConfig, "CacheZones", "cacheZones", []string{"api /opt/router/cache/api 100m 60m", "api /opt/router/cache/api 100m 60m, static /opt/router/cache/static 1g 1d"})
+}
+
+func TestInvalidCacheEnabled(t *testing.T) {
+	testInvalidValues(t, newTestCacheConfig, "Enabled", "enabled", []string{"0", "-1", "foobar"})
+}
+
+func TestValidCacheEnabled(t *testing.T) {
+	testValidValues(t, newTestCacheConfig, "Enabled", "enabled", []string{"true", "false", "TRUE", "FALSE"})
+}
+
+func TestInvalidCacheZone(t *testing.T) {
+	testInvalidValues(t, newTestCacheConfig, "Zone", "zone", []string{"API", "api-zone", "api zone"})
+}
+
+func TestValidCacheZone(t *testing.T) {
+	testValidValues(t, newTestCacheConfig, "Zone", "zone", []string{"api", "static_assets", "zone1"})
+}
+
+func TestInvalidCacheKey(t *testing.T) {
+	testInvalidValues(t, newTestCacheConfig, "Key", "key", []string{"$host $request_uri", "$host;", "\"$host\""})
+}
+
+func TestValidCacheKey(t *testing.T) {
+	testValidValues(t, newTestCacheConfig, "Key", "key", []string{"$host$request_uri", "$scheme$request_method$host$request_uri", "$host$uri$cookie_user"})
+}
+
+func TestInvalidCacheValid(t *testing.T) {
+	testInvalidValues(t, newTestCacheConfig, "Valid", "valid", []string{"foobar", "200 foo", "999 10m", "200 -1m"})
+}
+
+func TestValidCacheValid(t *testing.T) {
+	testValidValues(t, newTestCacheConfig, "Valid", "valid", []string{"10m", "200 10m", "200 302 10m, 404 1m", "any 5m"})
+}
+
+func TestInvalidCacheBypass(t *testing.T) {
+	testInvalidValues(t, newTestCacheConfig, "Bypass", "bypass", []string{"foobar", "$cookie-nocache", "$arg_nocache;"})
+}
+
+func TestValidCacheBypass(t *testing.T) {
+	testValidValues(t, newTestCacheConfig, "Bypass", "bypass", []string{"$cookie_nocache", "$cookie_nocache, $http_authorization"})
+}
+
+func TestInvalidCacheStaleWhileRevalidate(t *testing.T) {
+	testInvalidValues(t, newTestCacheConfig, "StaleWhileRevalidate", "staleWhileRevalidate", []string{"0", "-1", "foobar"})
+}
+
+func TestValidCacheStaleWhileRevalidate(t *testing.T) {
+	testValidValues(t, newTestCacheConfig, "StaleWhileRevalidate", "staleWhileRevalidate", []string{"true", "false", "TRUE", "FALSE"})
+}
+
+func TestInvalidCacheStatusHeader(t *testing.T) {
+	testInvalidValues(t, newTestCacheConfig, "StatusHeader", "statusHeader", []string{"X Cache", "X-Cache:"})
+}
+
+func TestValidCacheStatusHeader(t *testing.T) {
+	testValidValues(t, newTestCacheConfig, "StatusHeader", "statusHeader", []string{"", "X-Cache-Status", "X-Cache"})
+}
+
+func TestInvalidRetryConditions(t *testing.T) {
+	testInvalidValues(t, newTestRetryConfig, "Conditions", "conditions", []string{"foobar", "http_501", "error timeout", "non_idempotent"})
+}
+
+func TestValidRetryConditions(t *testing.T) {
+	testValidValues(t, newTestRetryConfig, "Conditions", "conditions", []string{"off", "error", "error,timeout", "error, timeout, http_502, http_503, http_504"})
+}
+
+func TestInvalidRetryTries(t *testing.T) {
+	testInvalidValues(t, newTestRetryConfig, "Tries", "tries", []string{"0", "-1", "100", "foobar"})
+}
+
+func TestValidRetryTries(t *testing.T) {
+	testValidValues(t, newTestRetryConfig, "Tries", "tries", []string{"1", "3", "99"})
+}
+
+func TestInvalidRetryTimeout(t *testing.T) {
+	testInvalidValues(t, newTestRetryConfig, "Timeout", "timeout", []string{"-1", "foobar", "10x", "010s"})
+}
+
+func TestValidRetryTimeout(t *testing.T) {
+	testValidValues(t, newTestRetryConfig, "Timeout", "timeout", []string{"0", "10", "500ms", "10s", "1m"})
+}
+
+func TestInvalidRetryNonIdempotent(t *testing.T) {
+	testInvalidValues(t, newTestRetryConfig, "NonIdempotent", "nonIdempotent", []string{"0", "-1", "foobar"})
+}
+
+func TestValidRetryNonIdempotent(t *testing.T) {
+	testValidValues(t, newTestRetryConfig, "NonIdempotent", "nonIdempotent", []string{"true", "false", "TRUE", "FALSE"})
+}
+
+func TestInvalidKeepaliveConnections(t *testing.T) {
+	testInvalidValues(t, newTestKeepaliveConfig, "Connections", "connections", []string{"-1", "foobar", "1.5"})
+}
+
+func TestValidKeepaliveConnections(t *testing.T) {
+	testValidValues(t, newTestKeepaliveConfig, "Connections", "connections", []string{"0", "16", "128"})
+}
+
+func TestInvalidKeepaliveTimeout(t *testing.T) {
+	testInvalidValues(t, newTestKeepaliveConfig, "Timeout", "timeout", []string{"0", "-1", "foobar", "10x"})
+}
+
+func TestValidKeepaliveTimeout(t *testing.T) {
+	testValidValues(t, newTestKeepaliveConfig, "Timeout", "timeout", []string{"60", "60s", "500ms", "1m"})
+}
+
+func TestInvalidKeepaliveRequests(t *testing.T) {
+	testInvalidValues(t, newTestKeepaliveConfig, "Requests", "requests", []string{"0", "-1", "foobar"})
+}
+
+func TestValidKeepaliveRequests(t *testing.T) {
+	testValidValues(t, newTestKeepaliveConfig, "Requests", "requests", []string{"1", "100", "10000"})
+}
+
+func TestInvalidAppBackendProtocol(t *testing.T) {
+	testInvalidValues(t, newTestAppConfig, "BackendProtocol", "backendProtocol", []string{"foobar", "HTTP", "h2c", "tcp"})
+}
+
+func TestValidAppBackendProtocol(t *testing.T) {
+	testValidValues(t, newTestAppConfig, "BackendProtocol", "backendProtocol", []string{"http", "https", "grpc", "grpcs"})
+}
+
+func TestInvalidAppBackendPort(t *testing.T) {
+	testInvalidValues(t, newTestAppConfig, "BackendPort", "backendPort", []string{"0", "-1", "65536", "foobar"})
+}
+
+func TestValidAppBackendPort(t *testing.T) {
+	testValidValues(t, newTestAppConfig, "BackendPort", "backendPort", []string{"1", "80", "443", "8443", "65535"})
+}
+
+func TestInvalidGRPCDefaultDeadline(t *testing.T) {
+	testInvalidValues(t, newTestGRPCConfig, "DefaultDeadline", "defaultDeadline", []string{"30", "30s", "0S", "123456789S", "foobar"})
+}
+
+func TestValidGRPCDefaultDeadline(t *testing.T) {
+	testValidValues(t, newTestGRPCConfig, "DefaultDeadline", "defaultDeadline", []string{"30S", "500m", "5M", "1H", "100u", "99999999n"})
+}
+
+func TestInvalidBackendTLSServerName(t *testing.T) {
+	testInvalidValues(t, newTestBackendTLSConfig, "ServerName", "serverName", []string{"foo bar", "foo_bar", "-foo.example.com", "foo.example.com."})
+}
+
+func TestValidBackendTLSServerName(t *testing.T) {
+	testValidValues(t, newTestBackendTLSConfig, "ServerName", "serverName", []string{"foo", "bar.foo.svc.cluster.local", "api.example.com"})
+}
+
+func TestInvalidBackendTLSSNI(t *testing.T) {
+	testInvalidValues(t, newTestBackendTLSConfig, "SNI", "sni", []string{"0", "-1", "foobar"})
+}
+
+func TestValidBackendTLSSNI(t *testing.T) {
+	testValidValues(t, newTestBackendTLSConfig, "SNI", "sni", []string{"true", "false", "TRUE", "FALSE"})
+}
+
+func TestInvalidBackendTLSCASecret(t *testing.T) {
+	testInvalidValues(t, newTestBackendTLSConfig, "CASecret", "caSecret", []string{"Foo", "foo_bar", "-foo"})
+}
+
+func TestValidBackendTLSCASecret(t *testing.T) {
+	testValidValues(t, newTestBackendTLSConfig, "CASecret", "caSecret", []string{"foo", "backend-ca", "foo.bar"})
+}
+
+func TestInvalidBackendTLSVerifyDepth(t *testing.T) {
+	testInvalidValues(t, newTestBackendTLSConfig, "VerifyDepth", "verifyDepth", []string{"0", "-1", "100", "foobar"})
+}
+
+func TestValidBackendTLSVerifyDepth(t *testing.T) {
+	testValidValues(t, newTestBackendTLSConfig, "VerifyDepth", "verifyDepth", []string{"1", "2", "10"})
+}
+
+func TestInvalidBackendTLSClientCertSecret(t *testing.T) {
+	testInvalidValues(t, newTestBackendTLSConfig, "ClientCertSecret", "clientCertSecret", []string{"Foo", "foo_bar", "-foo"})
+}
+
+func TestValidBackendTLSClientCertSecret(t *testing.T) {
+	testValidValues(t, newTestBackendTLSConfig, "ClientCertSecret", "clientCertSecret", []string{"foo", "router-client-cert", "foo.bar"})
+}
+
+func TestInvalidStreamListenPort(t *testing.T) {
+	testInvalidValues(t, newTestStreamConfig, "ListenPort", "listenPort", []string{"0", "-1", "65536", "foobar"})
+}
+
+func TestValidStreamListenPort(t *testing.T) {
+	testValidValues(t, newTestStreamConfig, "ListenPort", "listenPort", []string{"1", "53", "5432", "65535"})
+}
+
+func TestInvalidStreamProtocol(t *testing.T) {
+	testInvalidValues(t, newTestStreamConfig, "Protocol", "protocol", []string{"TCP", "sctp", "http"})
+}
+
+func TestValidStreamProtocol(t *testing.T) {
+	testValidValues(t, newTestStreamConfig, "Protocol", "protocol", []string{"tcp", "udp"})
+}
+
+func TestInvalidStreamTargetPort(t *testing.T) {
+	testInvalidValues(t, newTestStreamConfig, "TargetPort", "targetPort", []string{"0", "-1", "65536", "foobar"})
+}
+
+func TestValidStreamTargetPort(t *testing.T) {
+	testValidValues(t, newTestStreamConfig, "TargetPort", "targetPort", []string{"1", "53", "5432", "65535"})
+}
+
+func TestInvalidStreamConnectTimeout(t *testing.T) {
+	testInvalidValues(t, newTestStreamConfig, "ConnectTimeout", "connectTimeout", []string{"0", "-1", "foobar"})
+}
+
+func TestValidStreamConnectTimeout(t *testing.T) {
+	testValidValues(t, newTestStreamConfig, "ConnectTimeout", "connectTimeout", []string{"1", "500ms", "10s", "1m"})
+}
+
+func TestInvalidStreamTimeout(t *testing.T) {
+	testInvalidValues(t, newTestStreamConfig, "Timeout", "timeout", []string{"0", "-1", "foobar"})
+}
+
+func TestValidStreamTimeout(t *testing.T) {
+	testValidValues(t, newTestStreamConfig, "Timeout", "timeout", []string{"1", "30s", "10m", "1h"})
+}
+
+func TestInvalidStreamProxyProtocol(t *testing.T) {
+	testInvalidValues(t, newTestStreamConfig, "ProxyProtocol", "proxyProtocol", []string{"0", "-1", "foobar"})
+}
+
+func TestValidStreamProxyProtocol(t *testing.T) {
+	testValidValues(t, newTestStreamConfig, "ProxyProtocol", "proxyProtocol", []string{"true", "false", "TRUE", "FALSE"})
+}
+
+func TestInvalidPassthroughDomains(t *testing.T) {
+	testInvalidValues(t, newTestPassthroughConfig, "Domains", "domains", []string{"foo_bar", "foo.example.com.", "-foo.example.com"})
+}
+
+func TestValidPassthroughDomains(t *testing.T) {
+	testValidValues(t, newTestPassthroughConfig, "Domains", "domains", []string{"foo", "foo.example.com", "*.example.com", "foo.example.com, bar.example.com"})
+}
+
+func TestInvalidPassthroughTargetPort(t *testing.T) {
+	testInvalidValues(t, newTestPassthroughConfig, "TargetPort", "targetPort", []string{"0", "-1", "65536", "foobar"})
+}
+
+func TestValidPassthroughTargetPort(t *testing.T) {
+	testValidValues(t, newTestPassthroughConfig, "TargetPort", "targetPort", []string{"1", "443", "8443", "65535"})
+}
+
+func TestInvalidPassthroughProxyProtocol(t *testing.T) {
+	testInvalidValues(t, newTestPassthroughConfig, "ProxyProtocol", "proxyProtocol", []string{"0", "-1", "foobar"})
+}
+
+func TestValidPassthroughProxyProtocol(t *testing.T) {
+	testValidValues(t, newTestPassthroughConfig, "ProxyProtocol", "proxyProtocol", []string{"true", "false", "TRUE", "FALSE"})
+}
+
+func TestInvalidIngressClass(t *testing.T) {
+	testInvalidValues(t, newTestRouterConfig, "IngressClass", "ingressClass", []string{"Deis", "-deis", "deis-", "deis_router"})
+}
+
+func TestValidIngressClass(t *testing.T) {
+	testValidValues(t, newTestRouterConfig, "IngressClass", "ingressClass", []string{"deis", "nginx", "deis-router", "router.deis.io"})
+}
+
 func testInvalidValues(
 	t *testing.T,
 	builder func() (interface{}, error),
@@ -450,6 +1042,26 @@ func newTestProxyBuffersConfig() (interface{}, error) {
 	return newProxyBuffersConfig(nil)
 }
 
+func newTestGeoIPConfig() (interface{}, error) {
+	return newGeoIPConfig(), nil
+}
+
+func newTestAccessLogConfig() (interface{}, error) {
+	return newAccessLogConfig(), nil
+}
+
+func newTestLogForwardingConfig() (interface{}, error) {
+	return newLogForwardingConfig(), nil
+}
+
+func newTestHeadersConfig() (interface{}, error) {
+	return newHeadersConfig(), nil
+}
+
+func newTestCORSConfig() (interface{}, error) {
+	return newCORSConfig(), nil
+}
+
 func checkError(t *testing.T, value string, err error) {
 	want := "modeler.ModelValidationError"
 	if err == nil {
@@ -460,3 +1072,39 @@ func checkError(t *testing.T, value string, err error) {
 		t.Errorf("Using value \"%s\", expected a %s, but got a %s", value, want, got)
 	}
 }
+
+func newTestErrorPagesConfig() (interface{}, error) {
+	return newErrorPagesConfig(), nil
+}
+
+func newTestMaintenanceConfig() (interface{}, error) {
+	return newMaintenanceConfig(), nil
+}
+
+func newTestCacheConfig() (interface{}, error) {
+	return newCacheConfig(), nil
+}
+
+func newTestRetryConfig() (interface{}, error) {
+	return newRetryConfig(), nil
+}
+
+func newTestKeepaliveConfig() (interface{}, error) {
+	return newKeepaliveConfig(), nil
+}
+
+func newTestGRPCConfig() (interface{}, error) {
+	return newGRPCConfig(), nil
+}
+
+func newTestBackendTLSConfig() (interface{}, error) {
+	return newBackendTLSConfig(), nil
+}
+
+func newTestStreamConfig() (interface{}, error) {
+	return newStreamConfig(), nil
+}
+
+func newTestPassthroughConfig() (interface{}, error) {
+	return newPassthroughConfig(), nil
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"fmt"
+	"log"
+
+	"k8s.io/client-go/1.4/pkg/api/v1"
+)
+
+// PassthroughConfig encapsulates the configuration of a routable service to which the router
+// forwards TLS connections, selected by SNI, without terminating them.
+type PassthroughConfig struct {
+	Name          string
+	Source        v1.ObjectReference
+	Domains       []string `key:"domains" constraint:"(?i)^((([a-z0-9]+(-*[a-z0-9]+)*)|((\\*\\.)?[a-z0-9]+(-*[a-z0-9]+)*\\.)+[a-z0-9]+(-*[a-z0-9]+)+)(\\s*,\\s*)?)+$"`
+	TargetPort    int      `key:"targetPort" constraint:"^([1-9]\\d{0,3}|[1-5]\\d{4}|6[0-4]\\d{3}|65[0-4]\\d{2}|655[0-2]\\d|6553[0-5])$"`
+	ProxyProtocol bool     `key:"proxyProtocol" constraint:"(?i)^(true|false)$"`
+	ServiceIP     string
+}
+
+func newPassthroughConfig() *PassthroughConfig {
+	return &PassthroughConfig{
+		TargetPort: 443,
+	}
+}
+
+// buildPassthroughConfig returns the TLS passthrough configuration for the given service, or nil
+// if the service doesn't ask for any of its domains to be passed through.
+func buildPassthroughConfig(service v1.Service, routerConfig *RouterConfig) (*PassthroughConfig, error) {
+	passthroughConfig := newPassthroughConfig()
+	passthroughConfig.Name = appName(service.ObjectMeta)
+	passthroughConfig.Source = newObjectReference("Service", service.ObjectMeta)
+	err := mapAnnotations(routerConfig, "Service", service.ObjectMeta, "passthrough", passthroughConfig)
+	if err != nil {
+		return nil, err
+	}
+	if len(passthroughConfig.Domains) == 0 {
+		return nil, nil
+	}
+	if service.Spec.ClusterIP == "" || service.Spec.ClusterIP == v1.ClusterIPNone {
+		log.Printf("WARN: Service for app %s has no cluster IP; not passing TLS connections through to it.\n", passthroughConfig.Name)
+		return nil, nil
+	}
+	passthroughConfig.ServiceIP = service.Spec.ClusterIP
+	return passthroughConfig, nil
+}
+
+// addPassthroughConfig adds the given passthrough configuration to the router's configuration.
+// Domains already passed through to another app, compared as domainKey does, are dropped from it,
+// and an error describing each such collision is returned.  Repeated domains are dropped
+// silently.  If no domains remain, the configuration is not added at all.
+func addPassthroughConfig(routerConfig *RouterConfig, passthroughConfig *PassthroughConfig) []error {
+	var errs []error
+	domains := []string{}
+	seen := map[string]bool{}
+	for _, domain := range passthroughConfig.Domains {
+		key := domainKey(routerConfig, domain)
+		if seen[key] {
+			continue
+		}
+		if existing := findPassthroughConfig(routerConfig, domain); existing != nil {
+			errs = append(errs, fmt.Errorf("domain %s requested by app %s is already passed through to app %s", domain, passthroughConfig.Name, existing.Name))
+			continue
+		}
+		seen[key] = true
+		domains = append(domains, domain)
+	}
+	if len(domains) > 0 {
+		passthroughConfig.Domains = domains
+		routerConfig.PassthroughConfigs = append(routerConfig.PassthroughConfigs, passthroughConfig)
+	}
+	return errs
+}
+
+// findPassthroughConfig returns the passthrough configuration that already passes the given
+// domain through, or nil if there is none.
+func findPassthroughConfig(routerConfig *RouterConfig, domain string) *PassthroughConfig {
+	key := domainKey(routerConfig, domain)
+	for _, passthroughConfig := range routerConfig.PassthroughConfigs {
+		for _, existingDomain := range passthroughConfig.Domains {
+			if domainKey(routerConfig, existingDomain) == key {
+				return passthroughConfig
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/1.4/pkg/api/v1"
+)
+
+func TestBuildPassthroughConfig(t *testing.T) {
+	service := v1.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "vault",
+			Namespace: "foo",
+			Annotations: map[string]string{
+				"router.deis.io/passthrough.domains":       "vault.example.com, vault",
+				"router.deis.io/passthrough.targetPort":    "8200",
+				"router.deis.io/passthrough.proxyProtocol": "true",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			ClusterIP: "1.2.3.4",
+		},
+	}
+
+	expectedConfig := &PassthroughConfig{
+		Name:          "foo/vault",
+		Source:        v1.ObjectReference{Kind: "Service", Namespace: "foo", Name: "vault"},
+		Domains:       []string{"vault.example.com", "vault"},
+		TargetPort:    8200,
+		ProxyProtocol: true,
+		ServiceIP:     "1.2.3.4",
+	}
+	actualConfig, err := buildPassthroughConfig(service, &RouterConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expectedConfig, actualConfig) {
+		t.Errorf("Expected %+v, but got %+v", expectedConfig, actualConfig)
+	}
+
+	// Headless services can't be routed to.
+	service.Spec.ClusterIP = v1.ClusterIPNone
+	actualConfig, err = buildPassthroughConfig(service, &RouterConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actualConfig != nil {
+		t.Errorf("Expected no passthrough for a headless service, but got %+v", actualConfig)
+	}
+
+	// Services that don't declare any passthrough domains aren't passed through to.
+	service.Spec.ClusterIP = "1.2.3.4"
+	service.Annotations = map[string]string{"router.deis.io/passthrough.targetPort": "8443"}
+	actualConfig, err = buildPassthroughConfig(service, &RouterConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actualConfig != nil {
+		t.Errorf("Expected no passthrough without domains, but got %+v", actualConfig)
+	}
+}
+
+func TestAddPassthroughConfig(t *testing.T) {
+	routerConfig := &RouterConfig{}
+	if errs := addPassthroughConfig(routerConfig, &PassthroughConfig{Name: "foo/vault", Domains: []string{"vault.example.com", "secrets.example.com"}}); len(errs) != 0 {
+		t.Errorf("Expected no errors, but got %v", errs)
+	}
+
+	// Domains already claimed are dropped, but the rest are kept.
+	passthroughConfig := &PassthroughConfig{Name: "bar/vault", Domains: []string{"secrets.example.com", "vault.bar.example.com"}}
+	if errs := addPassthroughConfig(routerConfig, passthroughConfig); len(errs) != 1 {
+		t.Errorf("Expected 1 error, but got %v", errs)
+	}
+	if expectedDomains := []string{"vault.bar.example.com"}; !reflect.DeepEqual(expectedDomains, passthroughConfig.Domains) {
+		t.Errorf("Expected domains %v, but got %v", expectedDomains, passthroughConfig.Domains)
+	}
+
+	// If no domains remain, the app isn't passed through to at all.
+	if errs := addPassthroughConfig(routerConfig, &PassthroughConfig{Name: "baz/vault", Domains: []string{"vault.example.com"}}); len(errs) != 1 {
+		t.Errorf("Expected 1 error, but got %v", errs)
+	}
+	if len(routerConfig.PassthroughConfigs) != 2 {
+		t.Errorf("Expected 2 passthroughs, but got %d", len(routerConfig.PassthroughConfigs))
+	}
+}
+
+func TestAddPassthroughConfigDomainKeys(t *testing.T) {
+	routerConfig := &RouterConfig{PlatformDomain: "example.com"}
+	if errs := addPassthroughConfig(routerConfig, &PassthroughConfig{Name: "foo/vault", Domains: []string{"vault", "Vault.example.com"}}); len(errs) != 0 {
+		t.Errorf("Expected no errors, but got %v", errs)
+	}
+	if expectedDomains := []string{"vault"}; !reflect.DeepEqual(expectedDomains, routerConfig.PassthroughConfigs[0].Domains) {
+		t.Errorf("Expected domains %v, but got %v", expectedDomains, routerConfig.PassthroughConfigs[0].Domains)
+	}
+
+	// A bare domain is a subdomain of the platform domain, whatever its case.
+	passthroughConfig := &PassthroughConfig{Name: "bar/vault", Domains: []string{"VAULT.example.com", "secrets"}}
+	if errs := addPassthroughConfig(routerConfig, passthroughConfig); len(errs) != 1 {
+		t.Errorf("Expected 1 error, but got %v", errs)
+	}
+	if expectedDomains := []string{"secrets"}; !reflect.DeepEqual(expectedDomains, passthroughConfig.Domains) {
+		t.Errorf("Expected domains %v, but got %v", expectedDomains, passthroughConfig.Domains)
+	}
+}
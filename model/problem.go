@@ -0,0 +1,98 @@
+package model
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"k8s.io/client-go/1.4/pkg/api/v1"
+)
+
+// Reasons for which the router reports a problem with an object's routing configuration.
+const (
+	ReasonInvalidAnnotation    = "InvalidAnnotation"
+	ReasonSecretNotFound       = "SecretNotFound"
+	ReasonConfigMapNotFound    = "ConfigMapNotFound"
+	ReasonEndpointsUnavailable = "EndpointsUnavailable"
+	ReasonDomainConflict       = "DomainConflict"
+	ReasonPortConflict         = "PortConflict"
+)
+
+// Problem describes something the router had to work around while building its configuration
+// from an object, and which the object's owners should therefore hear about.
+type Problem struct {
+	Object  v1.ObjectReference
+	Reason  string
+	Message string
+}
+
+func newObjectReference(kind string, meta v1.ObjectMeta) v1.ObjectReference {
+	return v1.ObjectReference{
+		Kind:      kind,
+		Namespace: meta.Namespace,
+		Name:      meta.Name,
+		UID:       meta.UID,
+	}
+}
+
+// addProblem records a problem with the given object, unless an identical problem has already
+// been recorded, e.g. while building another of an Ingress's hosts.
+func addProblem(routerConfig *RouterConfig, object v1.ObjectReference, reason string, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	for _, problem := range routerConfig.Problems {
+		if problem.Object == object && problem.Reason == reason && problem.Message == message {
+			return
+		}
+	}
+	routerConfig.Problems = append(routerConfig.Problems, &Problem{Object: object, Reason: reason, Message: message})
+}
+
+func describeObject(object v1.ObjectReference) string {
+	return fmt.Sprintf("%s %s/%s", object.Kind, object.Namespace, object.Name)
+}
+
+// reportDomainConflicts records a problem with each object that claims a domain also claimed by
+// another object.  Conflicting claims for routing are resolved by resolveDomainConflicts, and
+// for TLS passthrough by addPassthroughConfig, so this only finds domains that one object routes
+// and another passes through.
+func reportDomainConflicts(routerConfig *RouterConfig) {
+	claims := map[string][]v1.ObjectReference{}
+	domains := []string{}
+	claim := func(domain string, source v1.ObjectReference) {
+		key := domainKey(routerConfig, domain)
+		if _, ok := claims[key]; !ok {
+			domains = append(domains, key)
+		}
+		claims[key] = append(claims[key], source)
+	}
+	for _, appConfig := range routerConfig.AppConfigs {
+		for _, domain := range appConfig.Domains {
+			claim(domain, appConfig.Source)
+		}
+	}
+	for _, passthroughConfig := range routerConfig.PassthroughConfigs {
+		for _, domain := range passthroughConfig.Domains {
+			claim(domain, passthroughConfig.Source)
+		}
+	}
+	for _, domain := range domains {
+		sources := claims[domain]
+		if len(sources) < 2 {
+			continue
+		}
+		for _, source := range sources {
+			others := []string{}
+			for _, other := range sources {
+				if other != source {
+					others = append(others, describeObject(other))
+				}
+			}
+			if len(others) == 0 {
+				// The same object claims the domain more than once, e.g. for two of its ports.
+				continue
+			}
+			log.Printf("WARN: Domain %s claimed by %s is also claimed by %s.\n", domain, describeObject(source), strings.Join(others, ", "))
+			addProblem(routerConfig, source, ReasonDomainConflict, "Domain %s is also claimed by %s.", domain, strings.Join(others, ", "))
+		}
+	}
+}
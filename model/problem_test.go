@@ -0,0 +1,103 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/client-go/1.4/kubernetes/fake"
+	"k8s.io/client-go/1.4/pkg/api/unversioned"
+	"k8s.io/client-go/1.4/pkg/api/v1"
+	"k8s.io/client-go/1.4/pkg/apis/extensions/v1beta1"
+)
+
+func TestProblems(t *testing.T) {
+	routable := map[string]string{"router.deis.io/routable": "true"}
+	endpoints := []v1.EndpointSubset{{Addresses: []v1.EndpointAddress{{IP: "172.17.0.2"}}}}
+	kubeClient := fake.NewSimpleClientset(
+		&v1beta1.Deployment{ObjectMeta: v1.ObjectMeta{Name: routerName, Namespace: namespace}},
+		&v1.Service{
+			ObjectMeta: v1.ObjectMeta{Name: "foo", Namespace: "foo", UID: "1", CreationTimestamp: unversioned.NewTime(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)), Labels: routable, Annotations: map[string]string{
+				"router.deis.io/domains":        "foo, www.example.com",
+				"router.deis.io/certificates":   "www.example.com:www",
+				"router.deis.io/connectTimeout": "soon",
+			}},
+			Spec: v1.ServiceSpec{ClusterIP: "10.0.0.1"},
+		},
+		&v1.Endpoints{ObjectMeta: v1.ObjectMeta{Name: "foo", Namespace: "foo"}, Subsets: endpoints},
+		&v1.Service{
+			ObjectMeta: v1.ObjectMeta{Name: "bar", Namespace: "bar", UID: "2", CreationTimestamp: unversioned.NewTime(time.Date(2016, 2, 1, 0, 0, 0, 0, time.UTC)), Labels: routable, Annotations: map[string]string{"router.deis.io/domains": "bar, www.example.com"}},
+			Spec:       v1.ServiceSpec{ClusterIP: "10.0.0.2"},
+		},
+	)
+
+	routerConfig, err := Build(kubeClient)
+	if err != nil {
+		t.Fatalf("Encountered an error: %v", err)
+	}
+	foo := v1.ObjectReference{Kind: "Service", Namespace: "foo", Name: "foo", UID: "1"}
+	bar := v1.ObjectReference{Kind: "Service", Namespace: "bar", Name: "bar", UID: "2"}
+	expected := []*Problem{
+		{Object: foo, Reason: ReasonInvalidAnnotation, Message: `Ignoring value "soon" of annotation router.deis.io/connectTimeout, which is invalid; using the default instead.`},
+		{Object: foo, Reason: ReasonSecretNotFound, Message: "The secret www-cert holding the certificate for domain www.example.com was not found."},
+		{Object: bar, Reason: ReasonEndpointsUnavailable, Message: "Service bar/bar has no ready endpoints; requests for bar, www.example.com will fail."},
+		{Object: bar, Reason: ReasonDomainConflict, Message: "Not routing domain www.example.com to this app because Service foo/foo, which takes precedence, also claims it."},
+		{Object: foo, Reason: ReasonDomainConflict, Message: "Domain www.example.com is also claimed by Service bar/bar; it is routed to this app, which takes precedence."},
+	}
+	if len(routerConfig.Problems) != len(expected) {
+		t.Fatalf("Expected %d problems, but got %d: %v", len(expected), len(routerConfig.Problems), routerConfig.Problems)
+	}
+	for i, problem := range routerConfig.Problems {
+		if *problem != *expected[i] {
+			t.Errorf("Expected problem %+v, but got %+v", expected[i], problem)
+		}
+	}
+}
+
+func TestAddProblem(t *testing.T) {
+	routerConfig := &RouterConfig{}
+	object := v1.ObjectReference{Kind: "Ingress", Namespace: "foo", Name: "bar"}
+	addProblem(routerConfig, object, ReasonSecretNotFound, "The secret %s was not found.", "baz")
+	addProblem(routerConfig, object, ReasonSecretNotFound, "The secret %s was not found.", "baz")
+	addProblem(routerConfig, object, ReasonSecretNotFound, "The secret %s was not found.", "qux")
+	if len(routerConfig.Problems) != 2 {
+		t.Errorf("Expected identical problems to be recorded once, but got %v", routerConfig.Problems)
+	}
+}
+
+func TestStreamProblems(t *testing.T) {
+	routable := map[string]string{"router.deis.io/routable": "true"}
+	kubeClient := fake.NewSimpleClientset(
+		&v1beta1.Deployment{ObjectMeta: v1.ObjectMeta{Name: routerName, Namespace: namespace}},
+		&v1.Service{
+			ObjectMeta: v1.ObjectMeta{Name: "foo", Namespace: "foo", UID: "1", Labels: routable, Annotations: map[string]string{"router.deis.io/stream.listenPort": "5432"}},
+			Spec:       v1.ServiceSpec{ClusterIP: "10.0.0.1"},
+		},
+		&v1.Service{
+			ObjectMeta: v1.ObjectMeta{Name: "bar", Namespace: "bar", UID: "2", Labels: routable, Annotations: map[string]string{"router.deis.io/stream.listenPort": "5432"}},
+			Spec:       v1.ServiceSpec{ClusterIP: "10.0.0.2"},
+		},
+		&v1.Service{
+			ObjectMeta: v1.ObjectMeta{Name: "baz", Namespace: "baz", UID: "3", Labels: routable, Annotations: map[string]string{"router.deis.io/stream.listenPort": "8080"}},
+			Spec:       v1.ServiceSpec{ClusterIP: "10.0.0.3"},
+		},
+	)
+
+	routerConfig, err := Build(kubeClient)
+	if err != nil {
+		t.Fatalf("Encountered an error: %v", err)
+	}
+	if len(routerConfig.StreamConfigs) != 1 {
+		t.Errorf("Expected 1 stream, but got %d", len(routerConfig.StreamConfigs))
+	}
+	// Services are routed in the order they're listed, so bar loses port 5432 to foo.
+	expected := map[string]bool{"bar": true, "baz": true}
+	for _, problem := range routerConfig.Problems {
+		if problem.Reason != ReasonPortConflict || !expected[problem.Object.Name] {
+			t.Errorf("Unexpected problem %+v", problem)
+		}
+		delete(expected, problem.Object.Name)
+	}
+	if len(expected) != 0 {
+		t.Errorf("Expected port conflicts for %v, but got %v", expected, routerConfig.Problems)
+	}
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"fmt"
+	"log"
+
+	"k8s.io/client-go/1.4/pkg/api/v1"
+)
+
+// reservedStreamPorts are the ports, keyed by protocol, that the router itself listens on and
+// that therefore cannot be claimed by a routable service's stream.
+var reservedStreamPorts = map[string][]int{
+	"tcp": {8080, 6443, 6444, 9090, 9091, 9092},
+}
+
+// StreamConfig encapsulates the configuration of a routable service that is exposed through the
+// router as raw TCP or UDP rather than HTTP.
+type StreamConfig struct {
+	Name           string
+	Source         v1.ObjectReference
+	ListenPort     int    `key:"listenPort" constraint:"^([1-9]\\d{0,3}|[1-5]\\d{4}|6[0-4]\\d{3}|65[0-4]\\d{2}|655[0-2]\\d|6553[0-5])$"`
+	Protocol       string `key:"protocol" constraint:"^(tcp|udp)$"`
+	TargetPort     int    `key:"targetPort" constraint:"^([1-9]\\d{0,3}|[1-5]\\d{4}|6[0-4]\\d{3}|65[0-4]\\d{2}|655[0-2]\\d|6553[0-5])$"`
+	ConnectTimeout string `key:"connectTimeout" constraint:"^[1-9]\\d*(ms|[smhdwMy])?$"`
+	Timeout        string `key:"timeout" constraint:"^[1-9]\\d*(ms|[smhdwMy])?$"`
+	ProxyProtocol  bool   `key:"proxyProtocol" constraint:"(?i)^(true|false)$"`
+	ServiceIP      string
+}
+
+func newStreamConfig() *StreamConfig {
+	return &StreamConfig{
+		Protocol:       "tcp",
+		ConnectTimeout: "10s",
+		Timeout:        "10m",
+	}
+}
+
+// buildStreamConfig returns the stream configuration for the given service, or nil if the
+// service doesn't ask to be exposed as a stream.
+func buildStreamConfig(service v1.Service, routerConfig *RouterConfig) (*StreamConfig, error) {
+	streamConfig := newStreamConfig()
+	streamConfig.Name = appName(service.ObjectMeta)
+	streamConfig.Source = newObjectReference("Service", service.ObjectMeta)
+	err := mapAnnotations(routerConfig, "Service", service.ObjectMeta, "stream", streamConfig)
+	if err != nil {
+		return nil, err
+	}
+	if streamConfig.ListenPort == 0 {
+		return nil, nil
+	}
+	if service.Spec.ClusterIP == "" || service.Spec.ClusterIP == v1.ClusterIPNone {
+		log.Printf("WARN: Service for app %s has no cluster IP; not routing stream on port %d.\n", streamConfig.Name, streamConfig.ListenPort)
+		return nil, nil
+	}
+	streamConfig.ServiceIP = service.Spec.ClusterIP
+	if streamConfig.TargetPort == 0 {
+		streamConfig.TargetPort = streamConfig.ListenPort
+	}
+	// nginx cannot send the PROXY protocol header over UDP.
+	if streamConfig.Protocol == "udp" && streamConfig.ProxyProtocol {
+		log.Printf("WARN: The PROXY protocol is not supported for UDP; not sending it to app %s.\n", streamConfig.Name)
+		streamConfig.ProxyProtocol = false
+	}
+	return streamConfig, nil
+}
+
+// addStreamConfig adds the given stream to the router's configuration unless its listen port
+// collides with a port the router already uses, in which case the stream is rejected and an
+// error describing the collision is returned.
+func addStreamConfig(routerConfig *RouterConfig, streamConfig *StreamConfig) error {
+	if isReservedStreamPort(routerConfig, streamConfig.Protocol, streamConfig.ListenPort) {
+		return fmt.Errorf("%s port %d requested by app %s is reserved by the router", streamConfig.Protocol, streamConfig.ListenPort, streamConfig.Name)
+	}
+	for _, existing := range routerConfig.StreamConfigs {
+		if existing.Protocol == streamConfig.Protocol && existing.ListenPort == streamConfig.ListenPort {
+			return fmt.Errorf("%s port %d requested by app %s is already in use by app %s", streamConfig.Protocol, streamConfig.ListenPort, streamConfig.Name, existing.Name)
+		}
+	}
+	routerConfig.StreamConfigs = append(routerConfig.StreamConfigs, streamConfig)
+	return nil
+}
+
+func isReservedStreamPort(routerConfig *RouterConfig, protocol string, port int) bool {
+	if protocol == "tcp" && port == 2222 && routerConfig.BuilderConfig != nil {
+		return true
+	}
+	for _, reservedPort := range reservedStreamPorts[protocol] {
+		if port == reservedPort {
+			return true
+		}
+	}
+	return false
+}
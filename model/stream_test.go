@@ -0,0 +1,121 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/1.4/pkg/api/v1"
+)
+
+func TestBuildStreamConfig(t *testing.T) {
+	service := v1.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "mqtt",
+			Namespace: "foo",
+			Annotations: map[string]string{
+				"router.deis.io/stream.listenPort":    "1883",
+				"router.deis.io/stream.targetPort":    "11883",
+				"router.deis.io/stream.timeout":       "1h",
+				"router.deis.io/stream.proxyProtocol": "true",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			ClusterIP: "1.2.3.4",
+		},
+	}
+
+	expectedConfig := &StreamConfig{
+		Name:           "foo/mqtt",
+		Source:         v1.ObjectReference{Kind: "Service", Namespace: "foo", Name: "mqtt"},
+		ListenPort:     1883,
+		Protocol:       "tcp",
+		TargetPort:     11883,
+		ConnectTimeout: "10s",
+		Timeout:        "1h",
+		ProxyProtocol:  true,
+		ServiceIP:      "1.2.3.4",
+	}
+	actualConfig, err := buildStreamConfig(service, &RouterConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expectedConfig, actualConfig) {
+		t.Errorf("Expected %+v, but got %+v", expectedConfig, actualConfig)
+	}
+
+	// The target port defaults to the listen port, and UDP streams can't use the PROXY protocol.
+	service.Annotations = map[string]string{
+		"router.deis.io/stream.listenPort":    "53",
+		"router.deis.io/stream.protocol":      "udp",
+		"router.deis.io/stream.proxyProtocol": "true",
+	}
+	actualConfig, err = buildStreamConfig(service, &RouterConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actualConfig.TargetPort != 53 {
+		t.Errorf("Expected target port 53, but got %d", actualConfig.TargetPort)
+	}
+	if actualConfig.ProxyProtocol {
+		t.Errorf("Expected the PROXY protocol to be disabled for a UDP stream")
+	}
+
+	// Headless services can't be routed to.
+	service.Spec.ClusterIP = v1.ClusterIPNone
+	actualConfig, err = buildStreamConfig(service, &RouterConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actualConfig != nil {
+		t.Errorf("Expected no stream for a headless service, but got %+v", actualConfig)
+	}
+
+	// Services that don't declare a listen port aren't streams.
+	service.Spec.ClusterIP = "1.2.3.4"
+	service.Annotations = map[string]string{"router.deis.io/stream.protocol": "udp"}
+	actualConfig, err = buildStreamConfig(service, &RouterConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actualConfig != nil {
+		t.Errorf("Expected no stream without a listen port, but got %+v", actualConfig)
+	}
+}
+
+func TestAddStreamConfig(t *testing.T) {
+	routerConfig := &RouterConfig{BuilderConfig: newBuilderConfig()}
+	testCases := []struct {
+		streamConfig *StreamConfig
+		valid        bool
+	}{
+		{&StreamConfig{Name: "foo/postgres", ListenPort: 5432, Protocol: "tcp"}, true},
+		// The same port over the other protocol doesn't collide.
+		{&StreamConfig{Name: "foo/dns", ListenPort: 53, Protocol: "udp"}, true},
+		{&StreamConfig{Name: "foo/dns-tcp", ListenPort: 53, Protocol: "tcp"}, true},
+		{&StreamConfig{Name: "bar/postgres", ListenPort: 5432, Protocol: "tcp"}, false},
+		{&StreamConfig{Name: "bar/dns", ListenPort: 53, Protocol: "udp"}, false},
+		// Ports the router itself listens on are reserved.
+		{&StreamConfig{Name: "bar/http", ListenPort: 8080, Protocol: "tcp"}, false},
+		{&StreamConfig{Name: "bar/admin", ListenPort: 9091, Protocol: "tcp"}, false},
+		{&StreamConfig{Name: "bar/metrics", ListenPort: 9092, Protocol: "tcp"}, false},
+		{&StreamConfig{Name: "bar/ssh", ListenPort: 2222, Protocol: "tcp"}, false},
+		{&StreamConfig{Name: "bar/http-udp", ListenPort: 8080, Protocol: "udp"}, true},
+	}
+	for _, testCase := range testCases {
+		err := addStreamConfig(routerConfig, testCase.streamConfig)
+		if testCase.valid && err != nil {
+			t.Errorf("Expected stream for %s to be added, but got error: %v", testCase.streamConfig.Name, err)
+		} else if !testCase.valid && err == nil {
+			t.Errorf("Expected stream for %s to be rejected, but it was added", testCase.streamConfig.Name)
+		}
+	}
+	if len(routerConfig.StreamConfigs) != 4 {
+		t.Errorf("Expected 4 streams, but got %d", len(routerConfig.StreamConfigs))
+	}
+
+	// Without the builder, its port is free.
+	routerConfig = &RouterConfig{}
+	if err := addStreamConfig(routerConfig, &StreamConfig{Name: "foo/ssh", ListenPort: 2222, Protocol: "tcp"}); err != nil {
+		t.Errorf("Expected port 2222 to be available without the builder, but got error: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/deis/router/model"
+)
+
+// cacheFileHeaderSize is the number of bytes read from the start of a cache file in search of
+// the key it was stored under.
+const cacheFileHeaderSize = 16384
+
+var cacheFileKeyMarker = []byte("\nKEY: ")
+
+// PurgeCache removes all of an app's cached responses from the cache zone the app uses and
+// returns the number of responses removed.  nginx treats a missing cache file as a cache miss, so
+// files may safely be removed while nginx is running.
+func PurgeCache(routerConfig *model.RouterConfig, appConfig *model.AppConfig) (int, error) {
+	var zonePath string
+	for _, cacheZone := range routerConfig.CacheZoneConfigs {
+		if cacheZone.Name == appConfig.Nginx.CacheConfig.Zone {
+			zonePath = cacheZone.Path
+		}
+	}
+	if zonePath == "" {
+		return 0, fmt.Errorf("Cache zone %s is not defined.", appConfig.Nginx.CacheConfig.Zone)
+	}
+	// Every cache key is prefixed with the name of the app it belongs to.  See the template.
+	keyPrefix := []byte(fmt.Sprintf("%s|", appConfig.Name))
+	purged := 0
+	err := filepath.Walk(zonePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// nginx's cache manager may have removed the file or directory in the meantime.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		key, err := readCacheKey(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !bytes.HasPrefix(key, keyPrefix) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		purged++
+		return nil
+	})
+	return purged, err
+}
+
+// readCacheKey returns the key an nginx cache file was stored under, or nil if the file does not
+// appear to be a cache file.
+func readCacheKey(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	header, err := ioutil.ReadAll(io.LimitReader(file, cacheFileHeaderSize))
+	if err != nil {
+		return nil, err
+	}
+	start := bytes.Index(header, cacheFileKeyMarker)
+	if start < 0 {
+		return nil, nil
+	}
+	key := header[start+len(cacheFileKeyMarker):]
+	end := bytes.IndexByte(key, '\n')
+	if end < 0 {
+		return nil, nil
+	}
+	return key[:end], nil
+}
@@ -0,0 +1,60 @@
+package nginx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deis/router/model"
+)
+
+func TestPurgeCache(t *testing.T) {
+	zonePath, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(zonePath)
+
+	cacheFiles := map[string]string{
+		"c/29/a1b2c29": "\x05\x00\x00\x00binary header\nKEY: foo/bar|httpGETfoo.example.com/\nHTTP/1.1 200 OK\n",
+		"d/3a/e4f53ad": "\x05\x00\x00\x00binary header\nKEY: foo/bar|httpGETfoo.example.com/baz\nHTTP/1.1 200 OK\n",
+		"e/4b/f5064be": "\x05\x00\x00\x00binary header\nKEY: foo/barbaz|httpGETbarbaz.example.com/\nHTTP/1.1 200 OK\n",
+		"f/5c/0617c5f": "not a cache file",
+	}
+	for name, contents := range cacheFiles {
+		path := filepath.Join(zonePath, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	routerConfig := &model.RouterConfig{
+		CacheZoneConfigs: []*model.CacheZone{{Name: "api", Path: zonePath, Size: "100m", Inactive: "60m"}},
+	}
+	appConfig := &model.AppConfig{
+		Name:  "foo/bar",
+		Nginx: &model.NginxAppConfig{CacheConfig: &model.CacheConfig{Enabled: true, Zone: "api"}},
+	}
+	purged, err := PurgeCache(routerConfig, appConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 2 {
+		t.Errorf("Expected 2 responses to be purged, but %d were.", purged)
+	}
+	for name, expectedRemoved := range map[string]bool{"c/29/a1b2c29": true, "d/3a/e4f53ad": true, "e/4b/f5064be": false, "f/5c/0617c5f": false} {
+		_, err := os.Stat(filepath.Join(zonePath, name))
+		if actualRemoved := os.IsNotExist(err); actualRemoved != expectedRemoved {
+			t.Errorf("Expected %s removed: %t, but got %t", name, expectedRemoved, actualRemoved)
+		}
+	}
+
+	appConfig.Nginx.CacheConfig.Zone = "static"
+	if _, err := PurgeCache(routerConfig, appConfig); err == nil {
+		t.Errorf("Expected an error purging an undefined cache zone, but got none.")
+	}
+}
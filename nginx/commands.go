@@ -1,19 +1,19 @@
 package nginx
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"strings"
 )
 
-const (
-	nginxBinary = "/opt/router/sbin/nginx"
-)
-
-// Start nginx.
-func Start() error {
+// Start nginx using the given binary and configuration file.
+func Start(binary string, confPath string) error {
 	log.Println("INFO: Starting nginx...")
-	cmd := exec.Command(nginxBinary)
+	cmd := exec.Command(binary, "-c", confPath)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Start(); err != nil {
@@ -23,15 +23,29 @@ func Start() error {
 	return nil
 }
 
-// Reload nginx configuration.
-func Reload() error {
+// Reload the configuration of nginx started using the given binary and configuration file.  The
+// configuration is tested first, and an error is returned, without reloading, if nginx rejects it.
+func Reload(binary string, confPath string) error {
 	log.Println("INFO: Reloading nginx...")
-	cmd := exec.Command(nginxBinary, "-s", "reload")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Start(); err != nil {
+	if err := run(binary, "-t", "-c", confPath); err != nil {
+		return err
+	}
+	if err := run(binary, "-c", confPath, "-s", "reload"); err != nil {
 		return err
 	}
 	log.Println("INFO: nginx reloaded.")
 	return nil
 }
+
+// run runs the given binary with the given arguments and waits for it to exit.  If it fails, the
+// returned error includes what it wrote to stderr.
+func run(binary string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s failed: %v: %s", binary, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package nginx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeStubBinary writes a shell script standing in for nginx to the given directory.  It records
+// its arguments in the file "calls" there and exits with the given status when testing the
+// configuration.
+func writeStubBinary(t *testing.T, dir string, testStatus int) string {
+	binary := filepath.Join(dir, "nginx")
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$*" >> %s
+if [ "$1" = "-t" ] && [ %d -ne 0 ]; then
+	echo "nginx: [emerg] unknown directive" >&2
+	exit %d
+fi
+`, filepath.Join(dir, "calls"), testStatus, testStatus)
+	if err := ioutil.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatalf("Encountered an error: %v", err)
+	}
+	return binary
+}
+
+func TestReload(t *testing.T) {
+	for _, test := range []struct {
+		testStatus    int
+		expectedCalls string
+		expectedError string
+	}{
+		{0, "-t -c /etc/nginx.conf\n-c /etc/nginx.conf -s reload\n", ""},
+		// nginx isn't asked to reload a configuration it rejects.
+		{1, "-t -c /etc/nginx.conf\n", "nginx: [emerg] unknown directive"},
+	} {
+		dir, err := ioutil.TempDir("", "commands")
+		if err != nil {
+			t.Fatalf("Encountered an error: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		binary := writeStubBinary(t, dir, test.testStatus)
+
+		err = Reload(binary, "/etc/nginx.conf")
+		if test.expectedError == "" && err != nil {
+			t.Errorf("Expected no error, but got %v", err)
+		}
+		if test.expectedError != "" && (err == nil || !strings.Contains(err.Error(), test.expectedError)) {
+			t.Errorf("Expected an error containing %q, but got %v", test.expectedError, err)
+		}
+		calls, err := ioutil.ReadFile(filepath.Join(dir, "calls"))
+		if err != nil {
+			t.Fatalf("Encountered an error: %v", err)
+		}
+		if string(calls) != test.expectedCalls {
+			t.Errorf("Expected nginx to be called with %q, but got %q", test.expectedCalls, calls)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"text/template"
 
 	"github.com/Masterminds/sprig"
@@ -12,8 +13,8 @@ import (
 )
 
 const (
-	confTemplate = `{{ $routerConfig := . }}daemon off;
-pid /tmp/nginx.pid;
+	confTemplate = `{{ $routerConfig := . }}{{ $passthroughEnabled := ne (len $routerConfig.PassthroughConfigs) 0 }}daemon off;
+pid {{ pidFile }};
 worker_processes {{ $routerConfig.WorkerProcesses }};
 
 events {
@@ -54,22 +55,37 @@ http {
 	{{ range $realIPCIDR := $routerConfig.ProxyRealIPCIDRs -}}
 	set_real_ip_from {{ $realIPCIDR }};
 	{{ end -}}
+	{{ if $passthroughEnabled -}}
+	# HTTPS requests reach the servers below through the passthrough stream server, which always
+	# sends the client's address using the PROXY protocol.
+	set_real_ip_from 127.0.0.1;
+	{{ end -}}
 	real_ip_recursive on;
 	{{ if $routerConfig.UseProxyProtocol -}}
 	real_ip_header proxy_protocol;
 	{{- else -}}
 	real_ip_header X-Forwarded-For;
 	{{- end }}
+	{{ with $routerConfig.GeoIPConfig }}{{ if .Enabled }}geoip_country {{ .CountryDatabase }};{{ end }}{{ end }}
 
+	{{ if eq $routerConfig.AccessLogConfig.Format "json" -}}
+	log_format upstreaminfo escape=json '{{ "{" }}{{ range $i, $field := $routerConfig.AccessLogConfig.Fields }}{{ if $i }},{{ end }}"{{ $field }}":"${{ $field }}"{{ end }}}';
+	{{- else -}}
 	log_format upstreaminfo '{{ $routerConfig.LogFormat }}';
+	{{- end }}
 
-	access_log /tmp/logpipe upstreaminfo;
-	error_log  /tmp/logpipe {{ $routerConfig.ErrorLogLevel }};
+	access_log {{ logPipe }} upstreaminfo;
+	error_log  {{ logPipe }} {{ $routerConfig.ErrorLogLevel }};
 
 	map $http_upgrade $connection_upgrade {
 		default upgrade;
 		'' close;
 	}
+	# Connections to back ends with keepalive enabled must not be closed after non-upgrade requests.
+	map $http_upgrade $keepalive_connection_upgrade {
+		default upgrade;
+		'' '';
+	}
 
 	# The next two maps work together to determine the $access_scheme:
 	# 1. Determine if SSL may have been offloaded by the load balancer, in such cases, an HTTP request should be
@@ -96,6 +112,7 @@ http {
 		default $server_port;
 		8080 80;
 		6443 443;
+		6444 443;
 	}
 	# 2. If the X-Forwarded-Port header has been set already (e.g. by a load balancer), use its
 	# value, otherwise, the port we're forwarding for is the $standard_server_port we determined
@@ -111,6 +128,9 @@ http {
 	}
 
 
+	{{ range $cacheZone := $routerConfig.CacheZoneConfigs }}proxy_cache_path {{ $cacheZone.Path }} levels=1:2 keys_zone={{ $cacheZone.Name }}:10m max_size={{ $cacheZone.Size }} inactive={{ $cacheZone.Inactive }} use_temp_path=off;
+	{{ end }}
+
 	{{ $sslConfig := $routerConfig.SSLConfig }}
 	{{ $hstsConfig := $sslConfig.HSTSConfig }}{{ if $hstsConfig.Enabled }}
 	# HSTS instructs the browser to replace all HTTP links with HTTPS links for this domain until maxAge seconds from now.
@@ -130,6 +150,9 @@ http {
 	{{/* Since HSTS headers are not permitted on HTTP requests, 301 redirects to HTTPS resources are also necessary. */}}
 	{{/* This means we force HTTPS if HSTS is enabled. */}}
 	{{ $enforceSecure := or $sslConfig.Enforce $hstsConfig.Enabled }}
+	{{/* HTTPS requests arriving through the passthrough stream server carry the PROXY protocol even when plain HTTP requests don't, */}}
+	{{/* so servers then listen for each in a separate block that takes clients' addresses from the right place. */}}
+	{{ $splitHTTPS := and $passthroughEnabled (not $routerConfig.UseProxyProtocol) }}
 
 	{{ if $routerConfig.DefaultServiceEnabled }}
 	server {
@@ -164,19 +187,20 @@ http {
 	{{ else }}
 
 	# Default server handles requests for unmapped hostnames, including healthchecks
-	server {
-		listen 8080 default_server reuseport{{ if $routerConfig.UseProxyProtocol }} proxy_protocol{{ end }};
-		listen 6443 default_server ssl {{ if $routerConfig.HTTP2Enabled }}http2{{ end }} {{ if $routerConfig.UseProxyProtocol }}proxy_protocol{{ end }};
+	{{ range $part := serverParts $splitHTTPS }}server {
+		{{ if ne $part "https" }}listen 8080 default_server reuseport{{ if $routerConfig.UseProxyProtocol }} proxy_protocol{{ end }};{{ end }}
+		{{ if ne $part "http" }}listen {{ if $passthroughEnabled }}127.0.0.1:6444{{ else }}6443{{ end }} default_server ssl {{ if $routerConfig.HTTP2Enabled }}http2{{ end }} {{ if or $routerConfig.UseProxyProtocol $passthroughEnabled }}proxy_protocol{{ end }};{{ end }}
+		{{ if eq $part "https" }}real_ip_header proxy_protocol;{{ end }}
 		set $app_name "router-default-vhost";
-		{{ if $routerConfig.PlatformCertificate }}
+		{{ if ne $part "http" }}{{ if $routerConfig.PlatformCertificate }}
 		ssl_protocols {{ $sslConfig.Protocols }};
-		ssl_certificate /opt/router/ssl/platform.crt;
-		ssl_certificate_key /opt/router/ssl/platform.key;
+		ssl_certificate {{ sslPath "platform.crt" }};
+		ssl_certificate_key {{ sslPath "platform.key" }};
 		{{ else }}
 		ssl_protocols TLSv1 TLSv1.1 TLSv1.2;
-		ssl_certificate /opt/router/ssl/default/default.crt;
-		ssl_certificate_key /opt/router/ssl/default/default.key;
-		{{ end }}
+		ssl_certificate {{ sslPath "default" "default.crt" }};
+		ssl_certificate_key {{ sslPath "default" "default.key" }};
+		{{ end }}{{ end }}
 		server_name _;
 		location ~ ^/healthz/?$ {
 			access_log off;
@@ -187,7 +211,7 @@ http {
 			return 404;
 		}
 	}
-	{{ end }}
+	{{ end }}{{ end }}
 
 	# Healthcheck on 9090 -- never uses proxy_protocol
 	server {
@@ -210,48 +234,211 @@ http {
 		      	allow 127.0.0.1;
 		      	deny all;
 		}
+		location /cache/ {
+			allow 127.0.0.1;
+			deny all;
+			proxy_pass http://127.0.0.1:9091;
+		}
+		location ~ ^/(config|routes)$ {
+			allow 127.0.0.1;
+			deny all;
+			proxy_pass http://127.0.0.1:9091;
+		}
 		location / {
 			return 404;
 		}
 	}
 
-	{{range $appConfig := $routerConfig.AppConfigs}}{{range $domain := $appConfig.Domains}}server {
-		listen 8080{{ if $routerConfig.UseProxyProtocol }} proxy_protocol{{ end }};
+	{{ range $appIndex, $appConfig := $routerConfig.AppConfigs }}{{ if and $appConfig.Maintenance (ne (len $appConfig.MaintenanceConfig.BypassWhitelist) 0) }}geo $maintenance_bypass_{{ $appIndex }} {
+		default 0;
+		{{ range $whitelistEntry := $appConfig.MaintenanceConfig.BypassWhitelist }}{{ $whitelistEntry }} 1;
+		{{ end }}
+	}
+	{{ end }}{{ end }}
+
+	{{ range $appIndex, $appConfig := $routerConfig.AppConfigs }}{{ if ne (len $appConfig.UpstreamServers) 0 }}upstream app_{{ $appIndex }} {
+		# {{ $appConfig.Name }}
+		{{ range $server := $appConfig.UpstreamServers }}server {{ $server }} max_fails=0;
+		{{ end }}
+		{{ $keepaliveConfig := $appConfig.Nginx.KeepaliveConfig }}{{ if gt $keepaliveConfig.Connections 0 }}keepalive {{ $keepaliveConfig.Connections }};
+		keepalive_timeout {{ $keepaliveConfig.Timeout }};
+		keepalive_requests {{ $keepaliveConfig.Requests }};{{ end }}
+	}
+	{{ end }}{{ range $locationIndex, $location := $appConfig.Locations }}{{ if ne (len $location.UpstreamServers) 0 }}upstream app_{{ $appIndex }}_{{ $locationIndex }} {
+		# {{ $appConfig.Name }} {{ $location.Path }} ({{ $location.Backend }})
+		{{ range $server := $location.UpstreamServers }}server {{ $server }} max_fails=0;
+		{{ end }}
+		{{ $keepaliveConfig := $appConfig.Nginx.KeepaliveConfig }}{{ if gt $keepaliveConfig.Connections 0 }}keepalive {{ $keepaliveConfig.Connections }};
+		keepalive_timeout {{ $keepaliveConfig.Timeout }};
+		keepalive_requests {{ $keepaliveConfig.Requests }};{{ end }}
+	}
+	{{ end }}{{ end }}{{ end }}
+
+	{{range $appIndex, $appConfig := $routerConfig.AppConfigs}}{{range $domain := $appConfig.Domains}}{{ range $part := serverParts $splitHTTPS }}{{ if or (ne $part "https") (index $appConfig.Certificates $domain) }}server {
+		{{ if ne $part "https" }}listen 8080{{ if $routerConfig.UseProxyProtocol }} proxy_protocol{{ end }};{{ end }}
 		server_name {{ if contains "." $domain }}{{ $domain }}{{ else if ne $routerConfig.PlatformDomain "" }}{{ $domain }}.{{ $routerConfig.PlatformDomain }}{{ else }}~^{{ $domain }}\.(?<domain>.+)${{ end }};
 		server_name_in_redirect off;
 		port_in_redirect off;
 		set $app_name "{{ $appConfig.Name }}";
 
-		{{ if index $appConfig.Certificates $domain }}
-		listen 6443 ssl {{ if $routerConfig.HTTP2Enabled }}http2{{ end }} {{ if $routerConfig.UseProxyProtocol }}proxy_protocol{{ end }};
+		{{ if and (ne $part "http") (index $appConfig.Certificates $domain) }}
+		listen {{ if $passthroughEnabled }}127.0.0.1:6444{{ else }}6443{{ end }} ssl {{ if $routerConfig.HTTP2Enabled }}http2{{ end }} {{ if or $routerConfig.UseProxyProtocol $passthroughEnabled }}proxy_protocol{{ end }};
+		{{ if eq $part "https" }}real_ip_header proxy_protocol;{{ end }}
 		ssl_protocols {{ $sslConfig.Protocols }};
 		{{ if ne $sslConfig.Ciphers "" }}ssl_ciphers {{ $sslConfig.Ciphers }};{{ end }}
 		ssl_prefer_server_ciphers on;
-		ssl_certificate /opt/router/ssl/{{ $domain }}.crt;
-		ssl_certificate_key /opt/router/ssl/{{ $domain }}.key;
+		ssl_certificate {{ sslPath (printf "%s.crt" $domain) }};
+		ssl_certificate_key {{ sslPath (printf "%s.key" $domain) }};
 		{{ if ne $sslConfig.SessionCache "" }}ssl_session_cache {{ $sslConfig.SessionCache }};
 		ssl_session_timeout {{ $sslConfig.SessionTimeout }};{{ end }}
 		ssl_session_tickets {{ if $sslConfig.UseSessionTickets }}on{{ else }}off{{ end }};
 		ssl_buffer_size {{ $sslConfig.BufferSize }};
-		{{ if ne $sslConfig.DHParam "" }}ssl_dhparam /opt/router/ssl/dhparam.pem;{{ end }}
+		{{ if ne $sslConfig.DHParam "" }}ssl_dhparam {{ sslPath "dhparam.pem" }};{{ end }}
 		{{ end }}
 
+		{{ range $blacklistEntry := $routerConfig.DefaultBlacklist }}deny {{ $blacklistEntry }};{{ end }}
+		{{ range $blacklistEntry := $appConfig.Blacklist }}deny {{ $blacklistEntry }};{{ end }}
 		{{ if or $routerConfig.EnforceWhitelists (or (ne (len $routerConfig.DefaultWhitelist) 0) (ne (len $appConfig.Whitelist) 0)) }}
 		{{ if or (eq (len $appConfig.Whitelist) 0) (eq $routerConfig.WhitelistMode "extend") }}{{ range $whitelistEntry := $routerConfig.DefaultWhitelist }}allow {{ $whitelistEntry }};{{ end }}{{ end }}
 		{{ range $whitelistEntry := $appConfig.Whitelist }}allow {{ $whitelistEntry }};{{ end }}
 		deny all;
 		{{ end }}
+		{{ if ne (len $appConfig.CountryWhitelist) 0 }}if ($geoip_country_code !~* "^({{ range $i, $country := $appConfig.CountryWhitelist }}{{ if $i }}|{{ end }}{{ $country }}{{ end }})$") {
+			return 403;
+		}{{ end }}
+		{{ if ne (len $appConfig.CountryBlacklist) 0 }}if ($geoip_country_code ~* "^({{ range $i, $country := $appConfig.CountryBlacklist }}{{ if $i }}|{{ end }}{{ $country }}{{ end }})$") {
+			return 403;
+		}{{ end }}
+
+		{{ $corsConfig := $appConfig.CORSConfig }}{{ if $corsConfig.Enabled }}
+		# CORS response headers are only added when the request's origin is allowed.  nginx omits
+		# headers whose values are empty.
+		set $cors_origin "";
+		set $cors_credentials "";
+		set $cors_expose_headers "";
+		if ($http_origin ~* "^({{ $corsConfig.OriginRegex }})$") {
+			set $cors_origin $http_origin;
+			{{ if $corsConfig.AllowCredentials }}set $cors_credentials "true";{{ end }}
+			set $cors_expose_headers "{{ range $i, $header := $corsConfig.ExposeHeaders }}{{ if $i }}, {{ end }}{{ $header }}{{ end }}";
+		}
+		set $cors_preflight "$cors_origin|$request_method|$http_access_control_request_method";
+		{{ end }}
+
+		{{ if ne (len $appConfig.RedirectRules) 0 }}set $redirect_url "$access_scheme://$host$request_uri";{{ end }}
+		{{ range $redirectRule := $appConfig.RedirectRules }}if ({{ if $redirectRule.MatchURL }}$redirect_url{{ else }}$request_uri{{ end }} ~ {{ nginxQuote $redirectRule.Source }}) {
+			return {{ $redirectRule.Status }} {{ nginxQuote $redirectRule.Target }};
+		}
+		{{ end }}
+		{{ range $rewriteRule := $appConfig.RewriteRules }}rewrite {{ nginxQuote $rewriteRule.Source }} {{ nginxQuote $rewriteRule.Target }} break;
+		{{ end }}
 
 		vhost_traffic_status_filter_by_set_key {{ $appConfig.Name }} application::*;
 
-		location / {
+		{{ $errorPagesConfig := $appConfig.ErrorPagesConfig }}
+		{{ range $name, $page := $errorPagesConfig.Pages }}{{ if and (ne $name "maintenance") (not (and $appConfig.Maintenance (eq $name "503"))) }}error_page {{ $name }} /__router_errors/{{ $name }}.html;
+		{{ end }}{{ end }}
+		{{ $isGRPC := or (eq $appConfig.BackendProtocol "grpc") (eq $appConfig.BackendProtocol "grpcs") }}{{ if $isGRPC }}
+		# gRPC clients expect errors to be reported using gRPC status codes.
+		error_page 502 503 = @grpc_unavailable;
+		error_page 504 = @grpc_deadline_exceeded;
+		location @grpc_unavailable {
+			internal;
+			default_type application/grpc;
+			add_header grpc-status 14 always;
+			add_header grpc-message "unavailable" always;
+			return 204;
+		}
+		location @grpc_deadline_exceeded {
+			internal;
+			default_type application/grpc;
+			add_header grpc-status 4 always;
+			add_header grpc-message "deadline exceeded" always;
+			return 204;
+		}
+		{{ end }}
+
+		{{ range $locationIndex, $location := $appConfig.Locations }}location {{ $location.Path }} {
+			{{ if ne (len $location.Whitelist) 0 }}
+			{{ range $blacklistEntry := $routerConfig.DefaultBlacklist }}deny {{ $blacklistEntry }};{{ end }}
+			{{ range $blacklistEntry := $appConfig.Blacklist }}deny {{ $blacklistEntry }};{{ end }}
+			{{ range $whitelistEntry := $location.Whitelist }}allow {{ $whitelistEntry }};{{ end }}
+			deny all;
+			{{ end }}
 			{{ if $routerConfig.RequestIDs }}
 			add_header X-Request-Id $request_id always;
 			add_header X-Correlation-Id $correlation_id always;
 			{{end}}
+			{{ $headersConfig := $appConfig.HeadersConfig }}
+			{{ range $name, $value := $headersConfig.AddResponse }}add_header {{ $name }} "{{ $value }}" always;
+			{{ end }}
+			{{ range $name, $value := $headersConfig.SetResponse }}add_header {{ $name }} "{{ $value }}" always;
+			{{ end }}
+			{{ if $corsConfig.Enabled }}
+			# Answer preflight requests from allowed origins directly.
+			if ($cors_preflight ~ "^[^|]+\|OPTIONS\|.+$") {
+				add_header Access-Control-Allow-Origin $cors_origin always;
+				add_header Access-Control-Allow-Methods "{{ range $i, $method := $corsConfig.AllowMethods }}{{ if $i }}, {{ end }}{{ $method }}{{ end }}" always;
+				add_header Access-Control-Allow-Headers "{{ range $i, $header := $corsConfig.AllowHeaders }}{{ if $i }}, {{ end }}{{ $header }}{{ end }}" always;
+				add_header Access-Control-Allow-Credentials $cors_credentials always;
+				add_header Access-Control-Max-Age {{ $corsConfig.MaxAge }} always;
+				add_header Vary Origin always;
+				return 204;
+			}
+			add_header Access-Control-Allow-Origin $cors_origin always;
+			add_header Access-Control-Allow-Credentials $cors_credentials always;
+			add_header Access-Control-Expose-Headers $cors_expose_headers always;
+			add_header Vary Origin always;
+			{{ end }}
 
-			{{ if $appConfig.Maintenance }}return 503;{{ else if $appConfig.Available }}
-			proxy_buffering {{ if $appConfig.Nginx.ProxyBuffersConfig.Enabled }}on{{ else }}off{{ end }};
+			{{ $maintenanceBypass := ne (len $appConfig.MaintenanceConfig.BypassWhitelist) 0 }}
+			{{ if and $appConfig.Maintenance (not $maintenanceBypass) }}return 503;{{ else if or (and (eq $location.Backend "") $appConfig.Available) $location.Available }}
+			{{ if $appConfig.Maintenance }}if ($maintenance_bypass_{{ $appIndex }} = 0) {
+				return 503;
+			}{{ end }}
+			{{ $retryConfig := $appConfig.Nginx.RetryConfig }}
+			{{ if $isGRPC }}
+			grpc_set_header Host $host;
+			grpc_set_header X-Forwarded-For $remote_addr;
+			grpc_set_header X-Forwarded-Proto $access_scheme;
+			grpc_set_header X-Forwarded-Port $forwarded_port;
+			grpc_connect_timeout {{ $appConfig.ConnectTimeout }};
+			grpc_send_timeout {{ $appConfig.TCPTimeout }};
+			grpc_read_timeout {{ $appConfig.TCPTimeout }};
+			grpc_next_upstream{{ range $condition := $retryConfig.Conditions }} {{ $condition }}{{ end }}{{ if $retryConfig.NonIdempotent }} non_idempotent{{ end }};
+			grpc_next_upstream_tries {{ $retryConfig.Tries }};
+			grpc_next_upstream_timeout {{ $retryConfig.Timeout }};
+			{{ if eq $appConfig.BackendProtocol "grpcs" }}{{ $backendTLSConfig := $appConfig.BackendTLSConfig }}
+			grpc_ssl_server_name {{ if $backendTLSConfig.SNI }}on{{ else }}off{{ end }};
+			{{ if ne $location.Backend "" }}{{ if ne $location.ServerName "" }}grpc_ssl_name {{ $location.ServerName }};{{ end }}{{ else if ne $backendTLSConfig.ServerName "" }}grpc_ssl_name {{ $backendTLSConfig.ServerName }};{{ end }}
+			{{ if ne $backendTLSConfig.CA "" }}grpc_ssl_verify on;
+			grpc_ssl_verify_depth {{ $backendTLSConfig.VerifyDepth }};
+			grpc_ssl_trusted_certificate {{ sslPath "backends" $appConfig.Name "ca.crt" }};{{ end }}
+			{{ if $backendTLSConfig.ClientCertificate }}grpc_ssl_certificate {{ sslPath "backends" $appConfig.Name "client.crt" }};
+			grpc_ssl_certificate_key {{ sslPath "backends" $appConfig.Name "client.key" }};{{ end }}
+			{{ end }}
+			{{ if $routerConfig.RequestIDs }}
+			grpc_set_header X-Request-Id $request_id;
+			grpc_set_header X-Correlation-Id $correlation_id;
+			{{ end }}
+			{{ range $name, $value := $headersConfig.SetRequest }}grpc_set_header {{ $name }} "{{ $value }}";
+			{{ end }}
+			{{ range $name := $headersConfig.HideRequest }}grpc_set_header {{ $name }} "";
+			{{ end }}
+			{{ range $name, $value := $headersConfig.SetResponse }}grpc_hide_header {{ $name }};
+			{{ end }}
+			{{ range $name := $headersConfig.HideResponse }}grpc_hide_header {{ $name }};
+			{{ end }}
+			{{ if ne $appConfig.GRPCConfig.DefaultDeadline "" }}
+			# Apply the default deadline to calls that don't specify their own.
+			set $grpc_timeout $http_grpc_timeout;
+			if ($grpc_timeout = "") {
+				set $grpc_timeout "{{ $appConfig.GRPCConfig.DefaultDeadline }}";
+			}
+			grpc_set_header grpc-timeout $grpc_timeout;
+			{{ end }}
+			{{ else }}
+			{{ $cacheConfig := $appConfig.Nginx.CacheConfig }}
+			proxy_buffering {{ if or $appConfig.Nginx.ProxyBuffersConfig.Enabled $cacheConfig.Enabled }}on{{ else }}off{{ end }};
 			proxy_buffer_size {{ $appConfig.Nginx.ProxyBuffersConfig.Size }};
 			proxy_buffers {{ $appConfig.Nginx.ProxyBuffersConfig.Number }} {{ $appConfig.Nginx.ProxyBuffersConfig.Size }};
 			proxy_busy_buffers_size {{ $appConfig.Nginx.ProxyBuffersConfig.BusySize }};
@@ -263,13 +450,48 @@ http {
 			proxy_connect_timeout {{ $appConfig.ConnectTimeout }};
 			proxy_send_timeout {{ $appConfig.TCPTimeout }};
 			proxy_read_timeout {{ $appConfig.TCPTimeout }};
+			proxy_next_upstream{{ range $condition := $retryConfig.Conditions }} {{ $condition }}{{ end }}{{ if $retryConfig.NonIdempotent }} non_idempotent{{ end }};
+			proxy_next_upstream_tries {{ $retryConfig.Tries }};
+			proxy_next_upstream_timeout {{ $retryConfig.Timeout }};
+			{{ if eq $appConfig.BackendProtocol "https" }}{{ $backendTLSConfig := $appConfig.BackendTLSConfig }}
+			proxy_ssl_server_name {{ if $backendTLSConfig.SNI }}on{{ else }}off{{ end }};
+			{{ if ne $location.Backend "" }}{{ if ne $location.ServerName "" }}proxy_ssl_name {{ $location.ServerName }};{{ end }}{{ else if ne $backendTLSConfig.ServerName "" }}proxy_ssl_name {{ $backendTLSConfig.ServerName }};{{ end }}
+			{{ if ne $backendTLSConfig.CA "" }}proxy_ssl_verify on;
+			proxy_ssl_verify_depth {{ $backendTLSConfig.VerifyDepth }};
+			proxy_ssl_trusted_certificate {{ sslPath "backends" $appConfig.Name "ca.crt" }};{{ end }}
+			{{ if $backendTLSConfig.ClientCertificate }}proxy_ssl_certificate {{ sslPath "backends" $appConfig.Name "client.crt" }};
+			proxy_ssl_certificate_key {{ sslPath "backends" $appConfig.Name "client.key" }};{{ end }}
+			{{ end }}
 			proxy_http_version 1.1;
 			proxy_set_header Upgrade $http_upgrade;
-			proxy_set_header Connection $connection_upgrade;
+			proxy_set_header Connection {{ if gt $appConfig.Nginx.KeepaliveConfig.Connections 0 }}$keepalive_connection_upgrade{{ else }}$connection_upgrade{{ end }};
+			{{ if $errorPagesConfig.InterceptErrors }}proxy_intercept_errors on;{{ end }}
 			{{ if $routerConfig.RequestIDs }}
 			proxy_set_header X-Request-Id $request_id;
 			proxy_set_header X-Correlation-Id $correlation_id;
 			{{ end }}
+			{{ range $name, $value := $headersConfig.SetRequest }}proxy_set_header {{ $name }} "{{ $value }}";
+			{{ end }}
+			{{ range $name := $headersConfig.HideRequest }}proxy_set_header {{ $name }} "";
+			{{ end }}
+			{{ range $name, $value := $headersConfig.SetResponse }}proxy_hide_header {{ $name }};
+			{{ end }}
+			{{ range $name := $headersConfig.HideResponse }}proxy_hide_header {{ $name }};
+			{{ end }}
+			{{ if $cacheConfig.Enabled }}
+			# Cache keys are prefixed with the app's name so that an app's cache can be purged.
+			proxy_cache {{ $cacheConfig.Zone }};
+			proxy_cache_key "{{ $appConfig.Name }}|{{ $cacheConfig.Key }}";
+			{{ range $valid := $cacheConfig.Valid }}proxy_cache_valid {{ $valid }};
+			{{ end }}
+			{{ if ne (len $cacheConfig.Bypass) 0 }}proxy_cache_bypass{{ range $bypass := $cacheConfig.Bypass }} {{ $bypass }}{{ end }};
+			proxy_no_cache{{ range $bypass := $cacheConfig.Bypass }} {{ $bypass }}{{ end }};{{ end }}
+			{{ if $cacheConfig.StaleWhileRevalidate }}proxy_cache_use_stale error timeout updating http_500 http_502 http_503 http_504;
+			proxy_cache_background_update on;
+			proxy_cache_lock on;{{ end }}
+			{{ if ne $cacheConfig.StatusHeader "" }}add_header {{ $cacheConfig.StatusHeader }} $upstream_cache_status always;{{ end }}
+			{{ end }}
+			{{ end }}
 
 			{{ if or $enforceSecure $appConfig.SSLConfig.Enforce }}if ($access_scheme !~* "^https|wss$") {
 				return 301 $uri_scheme://$host$request_uri;
@@ -277,26 +499,75 @@ http {
 
 			{{ if $hstsConfig.Enabled }}add_header Strict-Transport-Security $sts always;{{ end }}
 
-			proxy_pass http://{{$appConfig.ServiceIP}}:80;{{ else }}return 503;{{ end }}
+			{{ if $isGRPC }}grpc_pass{{ else }}proxy_pass{{ end }} {{ $appConfig.BackendProtocol }}://app_{{ $appIndex }}{{ if ne $location.Backend "" }}_{{ $locationIndex }}{{ end }};{{ else }}return 503;{{ end }}
 		}
-		{{ if $appConfig.Maintenance }}error_page 503 @maintenance;
+		{{ end }}
+		{{ if ne (len $errorPagesConfig.Pages) 0 }}location ^~ /__router_errors/ {
+			internal;
+			alias {{ wwwPath $appConfig.Name }}/;
+		}
+		{{ end }}
+		{{ if and $appConfig.Maintenance (not $isGRPC) }}error_page 503 @maintenance;
 			location @maintenance {
-					root /;
-			    rewrite ^(.*)$ /www/maintenance.html break;
+			{{ if index $errorPagesConfig.Pages "maintenance" }}
+					root {{ wwwPath $appConfig.Name }};
+			    rewrite ^(.*)$ /maintenance.html break;
+			{{ else }}
+					root {{ dir maintenancePage }};
+			    rewrite ^(.*)$ /{{ base maintenancePage }} break;
+			{{ end }}
 			}
 		{{ end }}
 	}
 
-	{{end}}{{end}}
+	{{ end }}{{ end }}{{end}}{{end}}
 }
 
-{{ if $routerConfig.BuilderConfig }}{{ $builderConfig := $routerConfig.BuilderConfig }}stream {
-	server {
+{{ if or $routerConfig.BuilderConfig (ne (len $routerConfig.StreamConfigs) 0) $passthroughEnabled }}stream {
+	{{ if $routerConfig.BuilderConfig }}{{ $builderConfig := $routerConfig.BuilderConfig }}server {
 		listen 2222 {{ if $routerConfig.UseProxyProtocol }}proxy_protocol{{ end }};
 		proxy_connect_timeout {{ $builderConfig.ConnectTimeout }};
 		proxy_timeout {{ $builderConfig.TCPTimeout }};
 		proxy_pass {{$builderConfig.ServiceIP}}:2222;
+	}{{ end }}
+
+	{{ range $streamConfig := $routerConfig.StreamConfigs }}# {{ $streamConfig.Name }}
+	server {
+		listen {{ $streamConfig.ListenPort }}{{ if eq $streamConfig.Protocol "udp" }} udp{{ else if $routerConfig.UseProxyProtocol }} proxy_protocol{{ end }};
+		proxy_connect_timeout {{ $streamConfig.ConnectTimeout }};
+		proxy_timeout {{ $streamConfig.Timeout }};
+		{{ if $streamConfig.ProxyProtocol }}proxy_protocol on;
+		{{ end }}proxy_pass {{ $streamConfig.ServiceIP }}:{{ $streamConfig.TargetPort }};
+	}
+	{{ end }}
+
+	{{ if $passthroughEnabled }}# TLS connections are routed by SNI, either straight through to an app or, failing that, to the
+	# servers above that terminate TLS themselves.  Both are always sent the PROXY protocol so they
+	# can learn the client's address.
+	map $ssl_preread_server_name $passthrough_upstream {
+		hostnames;
+		{{ range $passthroughIndex, $passthroughConfig := $routerConfig.PassthroughConfigs }}{{ range $domain := $passthroughConfig.Domains }}{{ if contains "." $domain }}{{ $domain }}{{ else if ne $routerConfig.PlatformDomain "" }}{{ $domain }}.{{ $routerConfig.PlatformDomain }}{{ else }}~^{{ $domain }}\.{{ end }} unix:/tmp/passthrough_{{ $passthroughIndex }}.sock;
+		{{ end }}{{ end }}default 127.0.0.1:6444;
+	}
+
+	server {
+		listen 6443{{ if $routerConfig.UseProxyProtocol }} proxy_protocol{{ end }};
+		{{ if $routerConfig.UseProxyProtocol }}{{ range $realIPCIDR := $routerConfig.ProxyRealIPCIDRs }}set_real_ip_from {{ $realIPCIDR }};
+		{{ end }}{{ end }}ssl_preread on;
+		proxy_timeout {{ $routerConfig.DefaultTimeout }};
+		proxy_protocol on;
+		proxy_pass $passthrough_upstream;
+	}
+
+	{{ range $passthroughIndex, $passthroughConfig := $routerConfig.PassthroughConfigs }}# {{ $passthroughConfig.Name }}
+	server {
+		listen unix:/tmp/passthrough_{{ $passthroughIndex }}.sock proxy_protocol;
+		set_real_ip_from unix:;
+		proxy_timeout {{ $routerConfig.DefaultTimeout }};
+		{{ if $passthroughConfig.ProxyProtocol }}proxy_protocol on;
+		{{ end }}proxy_pass {{ $passthroughConfig.ServiceIP }}:{{ $passthroughConfig.TargetPort }};
 	}
+	{{ end }}{{ end }}
 }{{ end }}
 `
 )
@@ -339,6 +610,35 @@ func WriteCerts(routerConfig *model.RouterConfig, sslPath string) error {
 			}
 		}
 	}
+	return writeBackendCerts(routerConfig, filepath.Join(sslPath, "backends"))
+}
+
+// writeBackendCerts writes the CA bundles and client certs used for TLS connections to apps' back
+// ends.  Each app's files are written to a directory named for the app.
+func writeBackendCerts(routerConfig *model.RouterConfig, backendsPath string) error {
+	if err := os.RemoveAll(backendsPath); err != nil {
+		return err
+	}
+	for _, appConfig := range routerConfig.AppConfigs {
+		backendTLSConfig := appConfig.BackendTLSConfig
+		if backendTLSConfig == nil || (backendTLSConfig.CA == "" && backendTLSConfig.ClientCertificate == nil) {
+			continue
+		}
+		appPath := filepath.Join(backendsPath, appConfig.Name)
+		if err := os.MkdirAll(appPath, 0700); err != nil {
+			return err
+		}
+		if backendTLSConfig.CA != "" {
+			if err := ioutil.WriteFile(filepath.Join(appPath, "ca.crt"), []byte(backendTLSConfig.CA), 0644); err != nil {
+				return err
+			}
+		}
+		if backendTLSConfig.ClientCertificate != nil {
+			if err := writeCert("client", backendTLSConfig.ClientCertificate, appPath); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -352,6 +652,38 @@ func writeCert(context string, certificate *model.Certificate, sslPath string) e
 	return ioutil.WriteFile(keyPath, []byte(certificate.Key), 0600)
 }
 
+// WriteErrorPages writes apps' custom error and maintenance pages to file from router
+// configuration.  Each app's pages are written to a directory named for the app.
+func WriteErrorPages(routerConfig *model.RouterConfig, wwwPath string) error {
+	// Start by deleting all existing pages. This will ensure pages we no longer need are deleted.
+	// Pages that are still needed will simply be re-written.
+	allPagesGlob, err := filepath.Glob(filepath.Join(wwwPath, "*"))
+	if err != nil {
+		return err
+	}
+	for _, page := range allPagesGlob {
+		if err := os.RemoveAll(page); err != nil {
+			return err
+		}
+	}
+	for _, appConfig := range routerConfig.AppConfigs {
+		if appConfig.ErrorPagesConfig == nil || len(appConfig.ErrorPagesConfig.Pages) == 0 {
+			continue
+		}
+		appPath := filepath.Join(wwwPath, appConfig.Name)
+		if err := os.MkdirAll(appPath, 0755); err != nil {
+			return err
+		}
+		for name, page := range appConfig.ErrorPagesConfig.Pages {
+			pagePath := filepath.Join(appPath, fmt.Sprintf("%s.html", name))
+			if err := ioutil.WriteFile(pagePath, []byte(page), 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // WriteDHParam writes router DHParam to file from router configuration.
 func WriteDHParam(routerConfig *model.RouterConfig, sslPath string) error {
 	dhParamPath := filepath.Join(sslPath, "dhparam.pem")
@@ -369,10 +701,70 @@ func WriteDHParam(routerConfig *model.RouterConfig, sslPath string) error {
 	return nil
 }
 
+// nginxQuote returns the given string as a double-quoted nginx configuration parameter, so that
+// characters such as spaces, braces, and semicolons are taken literally.  nginx unescapes \\ and \"
+// within quotes, so backslashes and double quotes are escaped to survive intact.
+func nginxQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// serverParts returns the parts of a server's listeners to render as separate server blocks: a
+// single part, "", listening for both HTTP and HTTPS, or, if split, an "http" part and an "https"
+// part.
+func serverParts(split bool) []string {
+	if split {
+		return []string{"http", "https"}
+	}
+	return []string{""}
+}
+
+// Paths locates the files and directories to which nginx configuration refers.
+type Paths struct {
+	// SSL is the directory to which certs and dhparam are written.
+	SSL string
+	// WWW is the directory to which custom error pages are written.
+	WWW string
+	// LogPipe is the named pipe to which nginx writes its logs.
+	LogPipe string
+	// PIDFile is the file to which nginx writes its process ID.
+	PIDFile string
+	// MaintenancePage is the router's own maintenance page.
+	MaintenancePage string
+}
+
+// newConfigTemplate parses the nginx configuration template.  In addition to the sprig functions,
+// the template may use sslPath and wwwPath to refer to files within the given SSL and WWW
+// directories, logPipe, pidFile, and maintenancePage to refer to the other given paths, dir and
+// base to split paths, and nginxQuote to quote parameters.
+func newConfigTemplate(paths Paths) (*template.Template, error) {
+	funcs := sprig.TxtFuncMap()
+	funcs["sslPath"] = func(elem ...string) string {
+		return filepath.Join(append([]string{paths.SSL}, elem...)...)
+	}
+	funcs["wwwPath"] = func(elem ...string) string {
+		return filepath.Join(append([]string{paths.WWW}, elem...)...)
+	}
+	funcs["logPipe"] = func() string {
+		return paths.LogPipe
+	}
+	funcs["pidFile"] = func() string {
+		return paths.PIDFile
+	}
+	funcs["maintenancePage"] = func() string {
+		return paths.MaintenancePage
+	}
+	funcs["dir"] = filepath.Dir
+	funcs["base"] = filepath.Base
+	funcs["nginxQuote"] = nginxQuote
+	funcs["serverParts"] = serverParts
+	return template.New("nginx").Funcs(funcs).Parse(confTemplate)
+}
+
 // WriteConfig dynamically produces valid nginx configuration by combining a Router configuration
-// object with a data-driven template.
-func WriteConfig(routerConfig *model.RouterConfig, filePath string) error {
-	tmpl, err := template.New("nginx").Funcs(sprig.TxtFuncMap()).Parse(confTemplate)
+// object with a data-driven template.  The configuration refers to certs, error pages, and the other
+// files nginx uses by the given paths.
+func WriteConfig(routerConfig *model.RouterConfig, filePath string, paths Paths) error {
+	tmpl, err := newConfigTemplate(paths)
 	if err != nil {
 		return err
 	}
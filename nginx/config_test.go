@@ -9,9 +9,7 @@ import (
 	"reflect"
 	"regexp"
 	"testing"
-	"text/template"
 
-	"github.com/Masterminds/sprig"
 	"github.com/deis/router/model"
 )
 
@@ -171,6 +169,107 @@ func TestWriteDHParam(t *testing.T) {
 	}
 }
 
+func TestWriteErrorPages(t *testing.T) {
+	wwwPath, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(wwwPath)
+
+	// Pages left over from a previous configuration should be removed.
+	stalePath := filepath.Join(wwwPath, "stale", "app")
+	if err := os.MkdirAll(stalePath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	routerConfig := &model.RouterConfig{
+		AppConfigs: []*model.AppConfig{
+			{
+				Name: "foo/bar",
+				ErrorPagesConfig: &model.ErrorPagesConfig{
+					Pages: map[string]string{"maintenance": "<h1>Back soon</h1>", "404": "<h1>Not found</h1>"},
+				},
+			},
+			{
+				Name:              "foo/baz",
+				ErrorPagesConfig:  &model.ErrorPagesConfig{},
+				MaintenanceConfig: &model.MaintenanceConfig{},
+			},
+		},
+	}
+	if err := WriteErrorPages(routerConfig, wwwPath); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expectedPage := range routerConfig.AppConfigs[0].ErrorPagesConfig.Pages {
+		actualPage, err := ioutil.ReadFile(filepath.Join(wwwPath, "foo", "bar", fmt.Sprintf("%s.html", name)))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(actualPage) != expectedPage {
+			t.Errorf("Expected %s.html contents, %s, does not match actual contents, %s.", name, expectedPage, string(actualPage))
+		}
+	}
+	if _, err := os.Stat(filepath.Join(wwwPath, "foo", "baz")); err == nil {
+		t.Errorf("Expected no pages to be written for an app without custom pages.")
+	}
+	if _, err := os.Stat(filepath.Join(wwwPath, "stale")); err == nil {
+		t.Errorf("Expected stale pages to be removed, but they were found.")
+	}
+}
+
+func TestWriteBackendCerts(t *testing.T) {
+	sslPath, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sslPath)
+
+	routerConfig := &model.RouterConfig{
+		AppConfigs: []*model.AppConfig{
+			{
+				Name: "foo/bar",
+				BackendTLSConfig: &model.BackendTLSConfig{
+					CA:                "bizbaz",
+					ClientCertificate: &model.Certificate{Cert: "foo", Key: "bar"},
+				},
+			},
+			{
+				Name:             "foo/baz",
+				BackendTLSConfig: &model.BackendTLSConfig{},
+			},
+		},
+	}
+	if err := WriteCerts(routerConfig, sslPath); err != nil {
+		t.Fatal(err)
+	}
+
+	appPath := filepath.Join(sslPath, "backends", "foo", "bar")
+	actualCA, err := ioutil.ReadFile(filepath.Join(appPath, "ca.crt"))
+	if err != nil {
+		t.Error(err)
+	}
+	if string(actualCA) != "bizbaz" {
+		t.Errorf("Expected ca.crt contents, bizbaz, does not match actual contents, %s.", string(actualCA))
+	}
+	if err := checkCertAndKey(filepath.Join(appPath, "client.crt"), filepath.Join(appPath, "client.key"), "foo", "bar"); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(sslPath, "backends", "foo", "baz")); err == nil {
+		t.Errorf("Expected no back end certs to be written for an app without back end TLS.")
+	}
+
+	// Back end certs that are no longer needed are removed.
+	routerConfig.AppConfigs = nil
+	if err := WriteCerts(routerConfig, sslPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(appPath); err == nil {
+		t.Errorf("Expected back end certs to be removed, but they were found.")
+	}
+}
+
 func TestWriteConfig(t *testing.T) {
 	routerConfig := model.RouterConfig{}
 
@@ -180,7 +279,7 @@ func TestWriteConfig(t *testing.T) {
 	}
 	defer os.Remove(tmpFile.Name())
 
-	WriteConfig(&routerConfig, tmpFile.Name())
+	WriteConfig(&routerConfig, tmpFile.Name(), testPaths)
 
 	if _, err := os.Stat(tmpFile.Name()); os.IsNotExist(err) {
 		t.Errorf("Expected to find nginx config file. No file found.")
@@ -244,6 +343,7 @@ func TestDisableServerTokens(t *testing.T) {
 		BodySize:          "1m",
 		ProxyRealIPCIDRs:  []string{"10.0.0.0/8"},
 		ErrorLogLevel:     "error",
+		AccessLogConfig:   &model.AccessLogConfig{Format: "text"},
 		UseProxyProtocol:  false,
 		EnforceWhitelists: false,
 		WhitelistMode:     "extend",
@@ -266,7 +366,7 @@ func TestDisableServerTokens(t *testing.T) {
 
 	var b bytes.Buffer
 
-	tmpl, err := template.New("nginx").Funcs(sprig.TxtFuncMap()).Parse(confTemplate)
+	tmpl, err := newConfigTemplate(testPaths)
 
 	if err != nil {
 		t.Fatalf("Encountered an error: %v", err)
@@ -285,3 +385,654 @@ func TestDisableServerTokens(t *testing.T) {
 	}
 
 }
+
+// testPaths are the paths to which test configurations refer, the router's defaults.
+var testPaths = Paths{
+	SSL:             "/opt/router/ssl",
+	WWW:             "/opt/router/www",
+	LogPipe:         "/tmp/logpipe",
+	PIDFile:         "/tmp/nginx.pid",
+	MaintenancePage: "/www/maintenance.html",
+}
+
+func newTestRouterConfig() *model.RouterConfig {
+	return &model.RouterConfig{
+		WorkerProcesses:          "auto",
+		MaxWorkerConnections:     "768",
+		TrafficStatusZoneSize:    "1m",
+		DefaultTimeout:           "1300s",
+		ServerNameHashMaxSize:    "512",
+		ServerNameHashBucketSize: "64",
+		GzipConfig: &model.GzipConfig{
+			Enabled: false,
+		},
+		BodySize:         "1m",
+		ProxyRealIPCIDRs: []string{"10.0.0.0/8"},
+		ErrorLogLevel:    "error",
+		LogFormat:        "$remote_addr - $status",
+		AccessLogConfig:  &model.AccessLogConfig{Format: "text"},
+		WhitelistMode:    "extend",
+		SSLConfig: &model.SSLConfig{
+			Protocols:         "TLSv1 TLSv1.1 TLSv1.2",
+			SessionTimeout:    "10m",
+			UseSessionTickets: true,
+			BufferSize:        "4k",
+			HSTSConfig:        &model.HSTSConfig{},
+		},
+		ProxyBuffersConfig: &model.ProxyBuffersConfig{
+			Number:   8,
+			Size:     "4k",
+			BusySize: "8k",
+		},
+	}
+}
+
+func newTestAppConfig() *model.AppConfig {
+	return &model.AppConfig{
+		Name:              "foo/bar",
+		Domains:           []string{"foo.example.com"},
+		ConnectTimeout:    "30s",
+		TCPTimeout:        "1300s",
+		ServiceIP:         "1.2.3.4",
+		UpstreamServers:   []string{"1.2.3.4:80"},
+		BackendProtocol:   "http",
+		GRPCConfig:        &model.GRPCConfig{},
+		BackendTLSConfig:  &model.BackendTLSConfig{},
+		Certificates:      map[string]*model.Certificate{},
+		Available:         true,
+		SSLConfig:         &model.SSLConfig{},
+		Locations:         []*model.Location{{Path: "/"}},
+		HeadersConfig:     &model.HeadersConfig{},
+		CORSConfig:        &model.CORSConfig{},
+		ErrorPagesConfig:  &model.ErrorPagesConfig{},
+		MaintenanceConfig: &model.MaintenanceConfig{},
+		Nginx: &model.NginxAppConfig{
+			ProxyBuffersConfig: &model.ProxyBuffersConfig{
+				Number:   8,
+				Size:     "4k",
+				BusySize: "8k",
+			},
+			CacheConfig:     &model.CacheConfig{},
+			RetryConfig:     &model.RetryConfig{Conditions: []string{"error", "timeout"}, Tries: 1, Timeout: "0"},
+			KeepaliveConfig: &model.KeepaliveConfig{},
+		},
+	}
+}
+
+func renderConfig(t *testing.T, routerConfig *model.RouterConfig) string {
+	var b bytes.Buffer
+	tmpl, err := newConfigTemplate(testPaths)
+	if err != nil {
+		t.Fatalf("Encountered an error: %v", err)
+	}
+	err = tmpl.Execute(&b, routerConfig)
+	if err != nil {
+		t.Fatalf("Encountered an error: %v", err)
+	}
+	return b.String()
+}
+
+// newTestConfig returns a function producing a test router configuration with a single test app,
+// after applying the given changes to them.
+func newTestConfig(configure func(routerConfig *model.RouterConfig, appConfig *model.AppConfig)) func() *model.RouterConfig {
+	return func() *model.RouterConfig {
+		routerConfig := newTestRouterConfig()
+		appConfig := newTestAppConfig()
+		routerConfig.AppConfigs = []*model.AppConfig{appConfig}
+		configure(routerConfig, appConfig)
+		return routerConfig
+	}
+}
+
+// newTestPassthroughConfig returns a test router configuration with a single app and a TLS
+// passthrough for another app.
+func newTestPassthroughConfig(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+	routerConfig.PlatformDomain = "example.com"
+	appConfig.Certificates["foo.example.com"] = &model.Certificate{}
+	routerConfig.PassthroughConfigs = []*model.PassthroughConfig{
+		{
+			Name:          "foo/vault",
+			Domains:       []string{"vault.example.org", "vault"},
+			TargetPort:    8200,
+			ProxyProtocol: true,
+			ServiceIP:     "1.2.3.4",
+		},
+	}
+}
+
+// configTests are rendered by TestConfig.  Each test's configuration must match all of its
+// expected regular expressions and none of its unexpected ones.
+var configTests = []struct {
+	name         string
+	routerConfig func() *model.RouterConfig
+	expected     []string
+	unexpected   []string
+}{
+	{
+		name: "blacklists and country rules",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			routerConfig.DefaultBlacklist = []string{"5.6.7.8"}
+			routerConfig.GeoIPConfig = &model.GeoIPConfig{
+				Enabled:         true,
+				CountryDatabase: "/opt/router/geoip/GeoIP.dat",
+			}
+			appConfig.Whitelist = []string{"10.0.0.0/8"}
+			appConfig.Blacklist = []string{"10.1.2.3"}
+			appConfig.CountryWhitelist = []string{"US", "CA"}
+			appConfig.CountryBlacklist = []string{"KP"}
+		}),
+		expected: []string{
+			`(?m)^\s*geoip_country /opt/router/geoip/GeoIP\.dat;$`,
+			// Deny entries must precede allow entries since nginx stops at the first matching rule.
+			`deny 5\.6\.7\.8;\s*deny 10\.1\.2\.3;\s*allow 10\.0\.0\.0/8;\s*deny all;`,
+			`if \(\$geoip_country_code !~\* "\^\(US\|CA\)\$"\) \{\s*return 403;`,
+			`if \(\$geoip_country_code ~\* "\^\(KP\)\$"\) \{\s*return 403;`,
+		},
+	},
+	{
+		name: "path whitelists",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.Blacklist = []string{"10.1.2.3"}
+			appConfig.Locations = append(appConfig.Locations, &model.Location{Path: "/admin", Whitelist: []string{"10.0.0.0/8"}})
+		}),
+		expected: []string{
+			`location / \{[^}]*proxy_pass http://app_0;`,
+			// The path-specific location re-applies the blacklist, since nginx doesn't inherit access
+			// rules into a location that defines its own, and proxies just like the root location.
+			`location /admin \{\s*deny 10\.1\.2\.3;\s*allow 10\.0\.0\.0/8;\s*deny all;[^}]*proxy_pass http://app_0;`,
+		},
+	},
+	{
+		name: "headers",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.HeadersConfig = &model.HeadersConfig{
+				SetRequest:   map[string]string{"X-Tenant": "acme"},
+				HideRequest:  []string{"Cookie"},
+				AddResponse:  map[string]string{"Content-Security-Policy": "default-src 'self' https:"},
+				SetResponse:  map[string]string{"X-Frame-Options": "DENY"},
+				HideResponse: []string{"X-Powered-By"},
+			}
+		}),
+		expected: []string{
+			`(?m)^\s*proxy_set_header X-Tenant "acme";$`,
+			`(?m)^\s*proxy_set_header Cookie "";$`,
+			`(?m)^\s*add_header Content-Security-Policy "default-src 'self' https:" always;$`,
+			// Setting a response header replaces any value provided by the app.
+			`(?m)^\s*proxy_hide_header X-Frame-Options;$`,
+			`(?m)^\s*add_header X-Frame-Options "DENY" always;$`,
+			`(?m)^\s*proxy_hide_header X-Powered-By;$`,
+		},
+	},
+	{
+		name: "CORS",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.CORSConfig = &model.CORSConfig{
+				Enabled:          true,
+				AllowMethods:     []string{"GET", "POST"},
+				AllowHeaders:     []string{"Authorization", "Content-Type"},
+				ExposeHeaders:    []string{"X-Total-Count"},
+				AllowCredentials: true,
+				MaxAge:           600,
+				OriginRegex:      `https://example\.com`,
+			}
+		}),
+		expected: []string{
+			`if \(\$http_origin ~\* "\^\(https://example\\\.com\)\$"\) \{\s*set \$cors_origin \$http_origin;\s*set \$cors_credentials "true";\s*set \$cors_expose_headers "X-Total-Count";`,
+			`add_header Access-Control-Allow-Methods "GET, POST" always;`,
+			`add_header Access-Control-Allow-Headers "Authorization, Content-Type" always;`,
+			`add_header Access-Control-Max-Age 600 always;\s*add_header Vary Origin always;\s*return 204;`,
+			`(?m)^\s*add_header Access-Control-Allow-Origin \$cors_origin always;$`,
+		},
+	},
+	{
+		name: "redirects and rewrites",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.RedirectRules = []*model.RedirectRule{
+				{Source: `^https?://www\.example\.com(/.*)$`, Target: "https://example.com$1", Status: 301, MatchURL: true},
+				{Source: "^/old/(.*)$", Target: "/new/$1", Status: 308},
+			}
+			appConfig.RewriteRules = []*model.RewriteRule{
+				{Source: "^/api/v1/(.*)$", Target: "/$1"},
+				{Source: `^/a{2};"$`, Target: "/b"},
+			}
+		}),
+		expected: []string{
+			// Redirects render in order, followed by rewrites.  Patterns are quoted, with backslashes
+			// and double quotes escaped, so that nginx reads them exactly as given.
+			`set \$redirect_url "\$access_scheme://\$host\$request_uri";\s*` +
+				`if \(\$redirect_url ~ "\^https\?://www\\\\\.example\\\\\.com\(/\.\*\)\$"\) \{\s*return 301 "https://example\.com\$1";\s*\}\s*` +
+				`if \(\$request_uri ~ "\^/old/\(\.\*\)\$"\) \{\s*return 308 "/new/\$1";\s*\}\s*` +
+				`rewrite "\^/api/v1/\(\.\*\)\$" "/\$1" break;\s*` +
+				`rewrite "\^/a\{2\};\\"\$" "/b" break;`,
+		},
+	},
+	{
+		name: "error pages",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.ErrorPagesConfig = &model.ErrorPagesConfig{
+				InterceptErrors: true,
+				Pages:           map[string]string{"maintenance": "<h1>Back soon</h1>", "404": "", "503": ""},
+			}
+		}),
+		expected: []string{
+			`(?m)^\s*error_page 404 /__router_errors/404\.html;$`,
+			`(?m)^\s*error_page 503 /__router_errors/503\.html;$`,
+			`(?m)^\s*proxy_intercept_errors on;$`,
+			`location \^~ /__router_errors/ \{\s*internal;\s*alias /opt/router/www/foo/bar/;`,
+		},
+		// The maintenance page isn't an error page.
+		unexpected: []string{`error_page maintenance`},
+	},
+	{
+		name: "error pages in maintenance",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.Maintenance = true
+			appConfig.ErrorPagesConfig = &model.ErrorPagesConfig{
+				InterceptErrors: true,
+				Pages:           map[string]string{"maintenance": "<h1>Back soon</h1>", "404": "", "503": ""},
+			}
+		}),
+		// The custom maintenance page takes the place of the custom 503 page.
+		expected: []string{
+			`error_page 503 @maintenance;\s*location @maintenance \{\s*root /opt/router/www/foo/bar;\s*rewrite \^\(\.\*\)\$ /maintenance\.html break;`,
+		},
+		unexpected: []string{`error_page 503 /__router_errors/503\.html;`},
+	},
+	{
+		name: "maintenance",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.Maintenance = true
+		}),
+		// Without a bypass whitelist, all requests are answered with the maintenance page.
+		expected: []string{`location / \{[^}]*return 503;\s*\}`},
+	},
+	{
+		name: "maintenance bypass",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.Maintenance = true
+			appConfig.MaintenanceConfig.BypassWhitelist = []string{"10.0.0.0/8", "192.168.1.1"}
+		}),
+		// Whitelisted clients are still proxied to the app.
+		expected: []string{
+			`geo \$maintenance_bypass_0 \{\s*default 0;\s*10\.0\.0\.0/8 1;\s*192\.168\.1\.1 1;\s*\}`,
+			`if \(\$maintenance_bypass_0 = 0\) \{\s*return 503;\s*\}[^}]*proxy_pass http://app_0;`,
+		},
+	},
+	{
+		name: "maintenance bypass outside of maintenance",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.MaintenanceConfig.BypassWhitelist = []string{"10.0.0.0/8", "192.168.1.1"}
+		}),
+		unexpected: []string{`maintenance_bypass`},
+	},
+	{
+		name: "cache",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			routerConfig.CacheZoneConfigs = []*model.CacheZone{{Name: "api", Path: "/opt/router/cache/api", Size: "100m", Inactive: "60m"}}
+			appConfig.Nginx.CacheConfig = &model.CacheConfig{
+				Enabled:              true,
+				Zone:                 "api",
+				Key:                  "$scheme$request_method$host$request_uri",
+				Valid:                []string{"200 302 10m", "404 1m"},
+				Bypass:               []string{"$cookie_nocache", "$http_authorization"},
+				StaleWhileRevalidate: true,
+				StatusHeader:         "X-Cache-Status",
+			}
+		}),
+		expected: []string{
+			`(?m)^\s*proxy_cache_path /opt/router/cache/api levels=1:2 keys_zone=api:10m max_size=100m inactive=60m use_temp_path=off;$`,
+			// Caching requires buffering, even though buffering is disabled for the app.
+			`(?m)^\s*proxy_buffering on;$`,
+			`(?m)^\s*proxy_cache api;$`,
+			`(?m)^\s*proxy_cache_key "foo/bar\|\$scheme\$request_method\$host\$request_uri";$`,
+			`(?m)^\s*proxy_cache_valid 200 302 10m;$`,
+			`(?m)^\s*proxy_cache_valid 404 1m;$`,
+			`(?m)^\s*proxy_cache_bypass \$cookie_nocache \$http_authorization;$`,
+			`(?m)^\s*proxy_no_cache \$cookie_nocache \$http_authorization;$`,
+			`(?m)^\s*proxy_cache_use_stale error timeout updating http_500 http_502 http_503 http_504;$`,
+			`(?m)^\s*proxy_cache_background_update on;$`,
+			`(?m)^\s*add_header X-Cache-Status \$upstream_cache_status always;$`,
+		},
+	},
+	{
+		name: "cache not enabled",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			routerConfig.CacheZoneConfigs = []*model.CacheZone{{Name: "api", Path: "/opt/router/cache/api", Size: "100m", Inactive: "60m"}}
+			appConfig.Nginx.CacheConfig = &model.CacheConfig{Zone: "api"}
+		}),
+		// Apps that have not opted in aren't cached.
+		unexpected: []string{`proxy_cache `},
+	},
+	{
+		name: "retries",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.UpstreamServers = []string{"1.2.3.4:80", "1.2.3.4:80", "1.2.3.4:80"}
+			appConfig.Nginx.RetryConfig = &model.RetryConfig{
+				Conditions:    []string{"error", "timeout", "http_502"},
+				Tries:         3,
+				Timeout:       "10s",
+				NonIdempotent: true,
+			}
+		}),
+		expected: []string{
+			`upstream app_0 \{\s*# foo/bar\s*server 1\.2\.3\.4:80 max_fails=0;\s*server 1\.2\.3\.4:80 max_fails=0;\s*server 1\.2\.3\.4:80 max_fails=0;\s*\}`,
+			`(?m)^\s*proxy_next_upstream error timeout http_502 non_idempotent;$`,
+			`(?m)^\s*proxy_next_upstream_tries 3;$`,
+			`(?m)^\s*proxy_next_upstream_timeout 10s;$`,
+			`(?m)^\s*proxy_pass http://app_0;$`,
+		},
+	},
+	{
+		name: "unavailable app",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.Available = false
+			appConfig.UpstreamServers = nil
+		}),
+		// Unavailable apps have no upstream.
+		unexpected: []string{`upstream app_0`},
+	},
+	{
+		name:         "no keepalive",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {}),
+		// Without keepalive, connections to the back end are closed after every request.
+		expected:   []string{`(?m)^\s*proxy_set_header Connection \$connection_upgrade;$`},
+		unexpected: []string{`(?m)^\s*keepalive `},
+	},
+	{
+		name: "keepalive",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.Nginx.KeepaliveConfig = &model.KeepaliveConfig{Connections: 32, Timeout: "30s", Requests: 1000}
+		}),
+		expected: []string{
+			`upstream app_0 \{[^}]*keepalive 32;\s*keepalive_timeout 30s;\s*keepalive_requests 1000;\s*\}`,
+			`(?m)^\s*proxy_http_version 1\.1;$`,
+			// The Connection header is only cleared for requests that aren't upgrading the connection.
+			`map \$http_upgrade \$keepalive_connection_upgrade \{\s*default upgrade;\s*'' '';\s*\}`,
+			`(?m)^\s*proxy_set_header Connection \$keepalive_connection_upgrade;$`,
+		},
+	},
+	{
+		name: "gRPC",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.BackendProtocol = "grpcs"
+			appConfig.GRPCConfig = &model.GRPCConfig{DefaultDeadline: "30S"}
+			appConfig.HeadersConfig = &model.HeadersConfig{SetRequest: map[string]string{"X-Tenant": "acme"}}
+		}),
+		expected: []string{
+			`(?m)^\s*grpc_pass grpcs://app_0;$`,
+			`(?m)^\s*grpc_connect_timeout 30s;$`,
+			`(?m)^\s*grpc_read_timeout 1300s;$`,
+			`(?m)^\s*grpc_next_upstream error timeout;$`,
+			`(?m)^\s*grpc_set_header X-Tenant "acme";$`,
+			`set \$grpc_timeout \$http_grpc_timeout;\s*if \(\$grpc_timeout = ""\) \{\s*set \$grpc_timeout "30S";\s*\}\s*grpc_set_header grpc-timeout \$grpc_timeout;`,
+			`error_page 502 503 = @grpc_unavailable;`,
+			`location @grpc_unavailable \{\s*internal;\s*default_type application/grpc;\s*add_header grpc-status 14 always;`,
+			`error_page 504 = @grpc_deadline_exceeded;`,
+		},
+		unexpected: []string{`proxy_pass \S*app_0`},
+	},
+	{
+		name: "gRPC in maintenance",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.BackendProtocol = "grpcs"
+			appConfig.Maintenance = true
+		}),
+		// gRPC clients get a gRPC status, not the maintenance page.
+		unexpected: []string{`@maintenance`},
+	},
+	{
+		name: "HTTPS back end",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.BackendProtocol = "https"
+		}),
+		// Other back ends are proxied using the configured protocol.
+		expected: []string{`(?m)^\s*proxy_pass https://app_0;$`},
+	},
+	{
+		name: "back end TLS",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.BackendProtocol = "https"
+			appConfig.BackendTLSConfig = &model.BackendTLSConfig{
+				ServerName:        "bar.foo.svc.cluster.local",
+				SNI:               true,
+				VerifyDepth:       2,
+				CA:                "bizbaz",
+				ClientCertificate: &model.Certificate{},
+			}
+		}),
+		expected: []string{
+			`(?m)^\s*proxy_ssl_server_name on;$`,
+			`(?m)^\s*proxy_ssl_name bar\.foo\.svc\.cluster\.local;$`,
+			`(?m)^\s*proxy_ssl_verify on;$`,
+			`(?m)^\s*proxy_ssl_verify_depth 2;$`,
+			`(?m)^\s*proxy_ssl_trusted_certificate /opt/router/ssl/backends/foo/bar/ca\.crt;$`,
+			`(?m)^\s*proxy_ssl_certificate /opt/router/ssl/backends/foo/bar/client\.crt;$`,
+			`(?m)^\s*proxy_ssl_certificate_key /opt/router/ssl/backends/foo/bar/client\.key;$`,
+			`(?m)^\s*proxy_pass https://app_0;$`,
+		},
+	},
+	{
+		name: "back end TLS without a CA",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.BackendProtocol = "https"
+			appConfig.BackendTLSConfig = &model.BackendTLSConfig{ServerName: "bar.foo.svc.cluster.local"}
+		}),
+		// The back end's certificate isn't verified.
+		unexpected: []string{`proxy_ssl_verify|proxy_ssl_certificate`},
+	},
+	{
+		name: "gRPC back end TLS",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.BackendProtocol = "grpcs"
+			appConfig.BackendTLSConfig = &model.BackendTLSConfig{ServerName: "bar.foo.svc.cluster.local", CA: "bizbaz"}
+		}),
+		// gRPC back ends use the equivalent grpc_ssl directives.
+		expected: []string{`(?m)^\s*grpc_ssl_trusted_certificate /opt/router/ssl/backends/foo/bar/ca\.crt;$`},
+	},
+	{
+		name: "back end TLS per location",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.BackendProtocol = "https"
+			appConfig.BackendTLSConfig = &model.BackendTLSConfig{SNI: true, CA: "bizbaz"}
+			appConfig.Locations = append(appConfig.Locations,
+				&model.Location{Path: "/api", Backend: "foo/api:443", UpstreamServers: []string{"5.6.7.8:443"}, Available: true, ServerName: "api.foo.svc.cluster.local"},
+			)
+		}),
+		// Paths routed to other services expect those services' names, and no name at all is
+		// rendered where none could be derived, e.g. for an Ingress host without a default back end.
+		expected: []string{`location /api \{[^}]*proxy_ssl_name api\.foo\.svc\.cluster\.local;`},
+		unexpected: []string{
+			`proxy_ssl_name\s*;`,
+			`(?s)proxy_ssl_name .*proxy_ssl_name `,
+		},
+	},
+	{
+		name: "streams",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			routerConfig.UseProxyProtocol = true
+			routerConfig.StreamConfigs = []*model.StreamConfig{
+				{
+					Name:           "foo/postgres",
+					ListenPort:     5432,
+					Protocol:       "tcp",
+					TargetPort:     5433,
+					ConnectTimeout: "10s",
+					Timeout:        "1h",
+					ProxyProtocol:  true,
+					ServiceIP:      "1.2.3.4",
+				},
+				{
+					Name:           "foo/dns",
+					ListenPort:     53,
+					Protocol:       "udp",
+					TargetPort:     53,
+					ConnectTimeout: "10s",
+					Timeout:        "10m",
+					ServiceIP:      "5.6.7.8",
+				},
+			}
+		}),
+		expected: []string{
+			`# foo/postgres\s*server \{\s*listen 5432 proxy_protocol;\s*proxy_connect_timeout 10s;\s*proxy_timeout 1h;\s*proxy_protocol on;\s*proxy_pass 1\.2\.3\.4:5433;\s*\}`,
+			`# foo/dns\s*server \{\s*listen 53 udp;\s*proxy_connect_timeout 10s;\s*proxy_timeout 10m;\s*proxy_pass 5\.6\.7\.8:53;\s*\}`,
+		},
+		// There's no builder server without a builder.
+		unexpected: []string{`listen 2222`},
+	},
+	{
+		name: "no streams",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			routerConfig.UseProxyProtocol = true
+		}),
+		// Without a builder or any streams, there's no stream block at all.
+		unexpected: []string{`(?m)^stream \{`},
+	},
+	{
+		name: "no passthroughs",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			newTestPassthroughConfig(routerConfig, appConfig)
+			routerConfig.PassthroughConfigs = nil
+		}),
+		// Without any passthroughs, the router terminates TLS on 6443 itself.
+		expected:   []string{`(?m)^\s*listen 6443 ssl\s*;$`},
+		unexpected: []string{`ssl_preread`},
+	},
+	{
+		name: "passthrough",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			newTestPassthroughConfig(routerConfig, appConfig)
+			routerConfig.UseProxyProtocol = true
+		}),
+		expected: []string{
+			`(?m)^\s*listen 127\.0\.0\.1:6444 default_server ssl\s+proxy_protocol;$`,
+			`(?m)^\s*listen 127\.0\.0\.1:6444 ssl\s+proxy_protocol;$`,
+			`(?m)^\s*set_real_ip_from 127\.0\.0\.1;$`,
+			`map \$ssl_preread_server_name \$passthrough_upstream \{\s*hostnames;\s*vault\.example\.org unix:/tmp/passthrough_0\.sock;\s*vault\.example\.com unix:/tmp/passthrough_0\.sock;\s*default 127\.0\.0\.1:6444;\s*\}`,
+			`server \{\s*listen 6443 proxy_protocol;\s*set_real_ip_from 10\.0\.0\.0/8;\s*ssl_preread on;\s*proxy_timeout 1300s;\s*proxy_protocol on;\s*proxy_pass \$passthrough_upstream;\s*\}`,
+			`# foo/vault\s*server \{\s*listen unix:/tmp/passthrough_0\.sock proxy_protocol;\s*set_real_ip_from unix:;\s*proxy_timeout 1300s;\s*proxy_protocol on;\s*proxy_pass 1\.2\.3\.4:8200;\s*\}`,
+		},
+		// No HTTP server listens on 6443.
+		unexpected: []string{`(?m)^\s*listen 6443 (default_server )?ssl`},
+	},
+	{
+		name:         "passthrough without the PROXY protocol",
+		routerConfig: newTestConfig(newTestPassthroughConfig),
+		// Even without the PROXY protocol in front of the router, the passthrough stream server
+		// sends it to the HTTPS servers, which must take clients' addresses from it rather than
+		// seeing every request come from 127.0.0.1.  Plain HTTP requests still carry clients'
+		// addresses in X-Forwarded-For, so HTTP and HTTPS are served by separate servers.
+		expected: []string{
+			`(?m)^\s*set_real_ip_from 127\.0\.0\.1;$`,
+			`(?m)^\s*real_ip_recursive on;\s*real_ip_header X-Forwarded-For;$`,
+			`server \{\s*listen 8080 default_server reuseport;\s*set \$app_name "router-default-vhost";\s*server_name _;`,
+			`server \{\s*listen 127\.0\.0\.1:6444 default_server ssl\s+proxy_protocol;\s*real_ip_header proxy_protocol;\s*set \$app_name "router-default-vhost";\s*ssl_protocols`,
+			`server \{\s*listen 8080;\s*server_name foo\.example\.com;\s*server_name_in_redirect off;\s*port_in_redirect off;\s*set \$app_name "foo/bar";\s*vhost_traffic_status_filter_by_set_key foo/bar application::\*;`,
+			`server \{\s*server_name foo\.example\.com;\s*server_name_in_redirect off;\s*port_in_redirect off;\s*set \$app_name "foo/bar";\s*listen 127\.0\.0\.1:6444 ssl\s+proxy_protocol;\s*real_ip_header proxy_protocol;`,
+		},
+		// Neither the HTTP servers nor the healthcheck server take clients' addresses from the PROXY
+		// protocol.
+		unexpected: []string{
+			`(?m)^\s*listen 8080 .*proxy_protocol;$`,
+			`(?s)real_ip_header proxy_protocol;.*real_ip_header proxy_protocol;.*real_ip_header proxy_protocol;`,
+		},
+	},
+	{
+		name: "location back ends",
+		routerConfig: newTestConfig(func(routerConfig *model.RouterConfig, appConfig *model.AppConfig) {
+			appConfig.Locations = append(appConfig.Locations,
+				&model.Location{Path: "/api", Backend: "foo/api:8080", UpstreamServers: []string{"5.6.7.8:8080"}, Available: true},
+				&model.Location{Path: "/cart", Backend: "foo/cart:80"},
+			)
+		}),
+		expected: []string{
+			`upstream app_0_1 \{\s*# foo/bar /api \(foo/api:8080\)\s*server 5\.6\.7\.8:8080 max_fails=0;\s*\}`,
+			`location / \{[^}]*proxy_pass http://app_0;`,
+			`location /api \{[^}]*proxy_pass http://app_0_1;`,
+			`location /cart \{[^}]*return 503;`,
+		},
+		// Unavailable location back ends have no upstream.
+		unexpected: []string{`upstream app_0_2`},
+	},
+	{
+		name:         "access log format",
+		routerConfig: newTestRouterConfig,
+		expected:     []string{`(?m)^\s*log_format upstreaminfo '\$remote_addr - \$status';$`},
+	},
+	{
+		name: "JSON access log format",
+		routerConfig: func() *model.RouterConfig {
+			routerConfig := newTestRouterConfig()
+			routerConfig.AccessLogConfig = &model.AccessLogConfig{Format: "json", Fields: []string{"time_iso8601", "status", "upstream_connect_time"}}
+			return routerConfig
+		},
+		expected: []string{
+			`(?m)^\s*log_format upstreaminfo escape=json '\{"time_iso8601":"\$time_iso8601","status":"\$status","upstream_connect_time":"\$upstream_connect_time"\}';$`,
+			`(?m)^\s*access_log /tmp/logpipe upstreaminfo;$`,
+		},
+	},
+}
+
+func TestConfig(t *testing.T) {
+	for _, test := range configTests {
+		conf := renderConfig(t, test.routerConfig())
+		checkConfig(t, test.name, conf, test.expected, test.unexpected)
+	}
+}
+
+// checkConfig reports an error for each expected regular expression the given configuration
+// doesn't match and for each unexpected one it does.
+func checkConfig(t *testing.T, name string, conf string, expected []string, unexpected []string) {
+	for _, expectation := range expected {
+		if !regexp.MustCompile(expectation).MatchString(conf) {
+			t.Errorf("%s: expected the configuration to match %s, but it did not.", name, expectation)
+		}
+	}
+	for _, expectation := range unexpected {
+		if regexp.MustCompile(expectation).MatchString(conf) {
+			t.Errorf("%s: expected the configuration not to match %s, but it did.", name, expectation)
+		}
+	}
+}
+
+func TestConfigPaths(t *testing.T) {
+	routerConfig := newTestRouterConfig()
+	routerConfig.PlatformCertificate = &model.Certificate{}
+	appConfig := newTestAppConfig()
+	appConfig.BackendProtocol = "https"
+	appConfig.BackendTLSConfig = &model.BackendTLSConfig{CA: "bizbaz"}
+	appConfig.ErrorPagesConfig = &model.ErrorPagesConfig{Pages: map[string]string{"404": "not found"}}
+	appConfig.Maintenance = true
+	appConfig.MaintenanceConfig.BypassWhitelist = []string{"10.0.0.0/8"}
+	routerConfig.AppConfigs = []*model.AppConfig{appConfig}
+
+	var b bytes.Buffer
+	tmpl, err := newConfigTemplate(Paths{
+		SSL:             "/srv/router/ssl",
+		WWW:             "/srv/router/www",
+		LogPipe:         "/srv/router/run/logpipe",
+		PIDFile:         "/srv/router/run/nginx.pid",
+		MaintenancePage: "/srv/router/pages/maintenance.html",
+	})
+	if err != nil {
+		t.Fatalf("Encountered an error: %v", err)
+	}
+	err = tmpl.Execute(&b, routerConfig)
+	if err != nil {
+		t.Fatalf("Encountered an error: %v", err)
+	}
+
+	checkConfig(t, "config paths", b.String(),
+		[]string{
+			`(?m)^\s*ssl_certificate /srv/router/ssl/platform\.crt;$`,
+			`(?m)^\s*proxy_ssl_trusted_certificate /srv/router/ssl/backends/foo/bar/ca\.crt;$`,
+			`(?m)^\s*alias /srv/router/www/foo/bar/;$`,
+			`(?m)^pid /srv/router/run/nginx\.pid;$`,
+			`(?m)^\s*access_log /srv/router/run/logpipe upstreaminfo;$`,
+			`(?m)^\s*error_log  /srv/router/run/logpipe error;$`,
+			// The app has no maintenance page of its own, so the router's is served.
+			`location @maintenance \{\s*root /srv/router/pages;\s*rewrite \^\(\.\*\)\$ /maintenance\.html break;`,
+		},
+		// No references to the default paths remain.
+		[]string{`/opt/router/(ssl|www)`, `/tmp/`, `\s/www/`},
+	)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/deis/router/model"
+	"github.com/deis/router/nginx"
+	"github.com/deis/router/utils"
+	"github.com/deis/router/utils/manifest"
+	"k8s.io/client-go/1.4/kubernetes/fake"
+	"k8s.io/client-go/1.4/pkg/runtime"
+)
+
+// manifestFiles collects the values of a repeatable -f flag.
+type manifestFiles []string
+
+func (f *manifestFiles) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *manifestFiles) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// render builds router configuration from manifests instead of from a live cluster and writes
+// nginx configuration, certs, and error pages to an output directory.  It returns the process's
+// exit status: non-zero if the manifests can't be read or don't produce a valid configuration.
+func render(args []string) int {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	var files manifestFiles
+	flags.Var(&files, "f", "Manifest file to read, or - for stdin; may be repeated (default stdin)")
+	outPath := flags.String("o", "", "Directory to which nginx.conf and the ssl and www directories are written")
+	flags.Parse(args)
+	if *outPath == "" {
+		log.Println("ERROR: An output directory must be given using -o.")
+		return 2
+	}
+	if len(files) == 0 {
+		files = manifestFiles{"-"}
+	}
+	// Objects that don't specify a namespace belong to the router's own, in which it looks for
+	// its deployment and secrets.
+	namespace := utils.GetOpt("POD_NAMESPACE", "default")
+	objects := []runtime.Object{}
+	for _, file := range files {
+		decoded, err := readManifests(file, namespace)
+		if err != nil {
+			log.Printf("ERROR: Failed to read manifests from %s: %v", file, err)
+			return 1
+		}
+		objects = append(objects, decoded...)
+	}
+	// Unlike the running router, fail on any invalid annotation value rather than skipping it.
+	model.SetStrictValidation(true)
+	routerConfig, err := model.Build(fake.NewSimpleClientset(objects...))
+	if err != nil {
+		log.Printf("ERROR: Failed to build router configuration: %v", err)
+		return 1
+	}
+	outSSLPath := filepath.Join(*outPath, "ssl")
+	outWWWPath := filepath.Join(*outPath, "www")
+	for _, path := range []string{outSSLPath, outWWWPath} {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			log.Printf("ERROR: Failed to create %s: %v", path, err)
+			return 1
+		}
+	}
+	if err := nginx.WriteCerts(routerConfig, outSSLPath); err != nil {
+		log.Printf("ERROR: Failed to write certs: %v", err)
+		return 1
+	}
+	if err := nginx.WriteDHParam(routerConfig, outSSLPath); err != nil {
+		log.Printf("ERROR: Failed to write dhparam: %v", err)
+		return 1
+	}
+	if err := nginx.WriteErrorPages(routerConfig, outWWWPath); err != nil {
+		log.Printf("ERROR: Failed to write error pages: %v", err)
+		return 1
+	}
+	// The configuration refers to the certs and error pages just written, so that it can be tested
+	// as is, unless -ssl-path or -www-path say where they will be kept instead.
+	configSSLPath, configWWWPath := outSSLPath, outWWWPath
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "ssl-path":
+			configSSLPath = *sslPath
+		case "www-path":
+			configWWWPath = *wwwPath
+		}
+	})
+	if configSSLPath == outSSLPath {
+		if err := copyDefaultCert(*sslPath, outSSLPath); err != nil {
+			log.Printf("ERROR: Failed to copy the default cert: %v", err)
+			return 1
+		}
+	}
+	if err := nginx.WriteConfig(routerConfig, filepath.Join(*outPath, "nginx.conf"), nginxPaths(configSSLPath, configWWWPath)); err != nil {
+		log.Printf("ERROR: Failed to write nginx configuration: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// copyDefaultCert copies the default cert, which the router's image provides rather than the
+// manifests, from one ssl directory to another.  If there's no default cert to copy, nginx won't
+// accept the configuration, but it is otherwise complete, so only a warning is logged.
+func copyDefaultCert(fromPath string, toPath string) error {
+	if err := os.MkdirAll(filepath.Join(toPath, "default"), 0755); err != nil {
+		return err
+	}
+	for name, perm := range map[string]os.FileMode{"default.crt": 0644, "default.key": 0600} {
+		data, err := ioutil.ReadFile(filepath.Join(fromPath, "default", name))
+		if os.IsNotExist(err) {
+			log.Printf("WARN: No default cert found in %s; nginx will not accept the configuration without one.\n", fromPath)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(toPath, "default", name), data, perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readManifests(file string, namespace string) ([]runtime.Object, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return manifest.Decode(r, namespace)
+}
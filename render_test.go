@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+const testManifests = `{"apiVersion": "extensions/v1beta1", "kind": "Deployment", "metadata": {"name": "deis-router"}}
+{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "foo", "namespace": "foo", "labels": {"router.deis.io/routable": "true"},
+	"annotations": {"router.deis.io/domains": "foo.example.com", "router.deis.io/certificates": "foo.example.com:foo"}},
+	"spec": {"clusterIP": "10.0.0.10", "ports": [{"port": 80}]}}
+{"apiVersion": "v1", "kind": "Endpoints", "metadata": {"name": "foo", "namespace": "foo"},
+	"subsets": [{"addresses": [{"ip": "10.1.0.10"}], "ports": [{"port": 80}]}]}
+{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "foo-cert", "namespace": "foo"}, "stringData": {"tls.crt": "cert", "tls.key": "key"}}
+`
+
+func TestRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "render")
+	if err != nil {
+		t.Fatalf("Encountered an error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	manifestPath := filepath.Join(dir, "manifests.yaml")
+	if err := ioutil.WriteFile(manifestPath, []byte(testManifests), 0644); err != nil {
+		t.Fatalf("Encountered an error: %v", err)
+	}
+	outPath := filepath.Join(dir, "out")
+	// The default cert comes from the router's ssl directory rather than the manifests.
+	defaultSSLPath := filepath.Join(dir, "ssl")
+	if err := os.MkdirAll(filepath.Join(defaultSSLPath, "default"), 0755); err != nil {
+		t.Fatalf("Encountered an error: %v", err)
+	}
+	for _, name := range []string{"default.crt", "default.key"} {
+		if err := ioutil.WriteFile(filepath.Join(defaultSSLPath, "default", name), []byte(name), 0644); err != nil {
+			t.Fatalf("Encountered an error: %v", err)
+		}
+	}
+	defer func(path string) { *sslPath = path }(*sslPath)
+	*sslPath = defaultSSLPath
+
+	if status := render([]string{"-f", manifestPath, "-o", outPath}); status != 0 {
+		t.Fatalf("Expected exit status 0, but got %d", status)
+	}
+	confPath := filepath.Join(outPath, "nginx.conf")
+	conf, err := ioutil.ReadFile(confPath)
+	if err != nil {
+		t.Fatalf("Encountered an error: %v", err)
+	}
+	if !regexp.MustCompile(`(?m)^\s*server_name foo\.example\.com;$`).Match(conf) {
+		t.Errorf("Expected a server for foo.example.com in the configuration. Actual: no match")
+	}
+	// The configuration refers to the certs written alongside it.
+	certPaths := []string{}
+	for _, match := range regexp.MustCompile(`(?m)^\s*ssl_certificate(?:_key)? (\S+);$`).FindAllSubmatch(conf, -1) {
+		certPath := string(match[1])
+		certPaths = append(certPaths, certPath)
+		if _, err := os.Stat(certPath); err != nil {
+			t.Errorf("Expected the cert the configuration refers to to exist: %v", err)
+		}
+	}
+	expectedCertPaths := []string{
+		filepath.Join(outPath, "ssl", "default", "default.crt"),
+		filepath.Join(outPath, "ssl", "default", "default.key"),
+		filepath.Join(outPath, "ssl", "foo.example.com.crt"),
+		filepath.Join(outPath, "ssl", "foo.example.com.key"),
+	}
+	if !reflect.DeepEqual(expectedCertPaths, certPaths) {
+		t.Errorf("Expected certs %v, but got %v", expectedCertPaths, certPaths)
+	}
+
+	// The configuration must also be accepted by the router's nginx, which is only available in the
+	// router's image.
+	if _, err := os.Stat(*nginxBinary); err != nil {
+		t.Skipf("Not testing the configuration with nginx: %v", err)
+	}
+	if output, err := exec.Command(*nginxBinary, "-t", "-c", confPath).CombinedOutput(); err != nil {
+		t.Errorf("Expected nginx to accept the configuration, but it did not: %v\n%s", err, output)
+	}
+}
@@ -1,19 +1,55 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"net/http"
+	"os"
 	"reflect"
+	"time"
 
+	"github.com/deis/router/admin"
+	"github.com/deis/router/logs"
+	"github.com/deis/router/metrics"
 	"github.com/deis/router/model"
 	"github.com/deis/router/nginx"
+	"github.com/deis/router/status"
 	"k8s.io/client-go/1.4/kubernetes"
 	"k8s.io/client-go/1.4/pkg/util/flowcontrol"
 	"k8s.io/client-go/1.4/rest"
+	"k8s.io/client-go/1.4/tools/clientcmd"
+)
+
+var (
+	kubeconfig      = flag.String("kubeconfig", "", "Path to a kubeconfig file; if unset, the router uses its in-cluster service account")
+	kubeContext     = flag.String("context", "", "The kubeconfig context to use; defaults to the current context")
+	nginxBinary     = flag.String("nginx-binary", "/opt/router/sbin/nginx", "Path to the nginx binary")
+	nginxConf       = flag.String("nginx-conf", "/opt/router/conf/nginx.conf", "Path to which nginx configuration is written")
+	sslPath         = flag.String("ssl-path", "/opt/router/ssl", "Directory to which certificates and dhparam are written")
+	wwwPath         = flag.String("www-path", "/opt/router/www", "Directory to which custom error pages are written")
+	logPipePath     = flag.String("log-pipe", "/tmp/logpipe", "Named pipe to which nginx writes its access and error logs")
+	pidFile         = flag.String("pid-file", "/tmp/nginx.pid", "File to which nginx writes its process ID")
+	maintenancePage = flag.String("maintenance-page", "/www/maintenance.html", "The router's own maintenance page")
+	metricsAddr     = flag.String("metrics-address", ":9092", "Address on which Prometheus metrics are served")
 )
 
 func main() {
-	nginx.Start()
-	cfg, err := rest.InClusterConfig()
+	flag.Parse()
+	if flag.Arg(0) == "render" {
+		os.Exit(render(flag.Args()[1:]))
+	}
+	logPipe, err := logs.OpenPipe(*logPipePath)
+	if err != nil {
+		log.Fatalf("Failed to open the log pipe: %v", err)
+	}
+	logForwarder := logs.NewForwarder()
+	go func() {
+		log.Fatalf("Log forwarder failed: %v", logForwarder.Run(logPipe))
+	}()
+	if err := nginx.Start(*nginxBinary, *nginxConf); err != nil {
+		log.Fatalf("Failed to start nginx: %v", err)
+	}
+	cfg, err := buildClientConfig(*kubeconfig, *kubeContext)
 	if err != nil {
 		log.Fatalf("Failed to create config: %v", err)
 	}
@@ -21,40 +57,107 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to create client: %v.", err)
 	}
+	adminServer := admin.NewServer()
+	go func() {
+		log.Fatalf("Admin server failed: %v", adminServer.ListenAndServe("127.0.0.1:9091"))
+	}()
+	metricsCollector := metrics.NewCollector("http://127.0.0.1:9090/stats")
+	go func() {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metricsCollector)
+		log.Fatalf("Metrics server failed: %v", http.ListenAndServe(*metricsAddr, metricsMux))
+	}()
+	statusReporter := status.NewReporter(kubeClient)
 	rateLimiter := flowcontrol.NewTokenBucketRateLimiter(0.1, 1)
 	known := &model.RouterConfig{}
 	// Main loop
 	for {
 		rateLimiter.Accept()
-		routerConfig, err := model.Build(kubeClient)
-		if err != nil {
-			log.Printf("Error building model; not modifying certs or configuration: %v.", err)
-			continue
-		}
-		if reflect.DeepEqual(routerConfig, known) {
-			continue
-		}
-		log.Println("INFO: Router configuration has changed in k8s.")
-		err = nginx.WriteCerts(routerConfig, "/opt/router/ssl")
-		if err != nil {
-			log.Printf("Failed to write certs; continuing with existing certs, dhparam, and configuration: %v", err)
-			continue
-		}
-		err = nginx.WriteDHParam(routerConfig, "/opt/router/ssl")
-		if err != nil {
-			log.Printf("Failed to write dhparam; continuing with existing dhparam and configuration: %v", err)
-			continue
-		}
-		err = nginx.WriteConfig(routerConfig, "/opt/router/conf/nginx.conf")
+		start := time.Now()
+		routerConfig, err := applyRouterConfig(kubeClient, known, metricsCollector)
+		adminServer.SetBuildResult(err)
 		if err != nil {
-			log.Printf("Failed to write new nginx configuration; continuing with existing configuration: %v", err)
+			metricsCollector.ObserveReconcile("failed", time.Since(start))
 			continue
 		}
-		err = nginx.Reload()
-		if err != nil {
-			log.Printf("Failed to reload nginx; continuing with existing configuration: %v", err)
+		if routerConfig == known {
+			metricsCollector.ObserveReconcile("unchanged", time.Since(start))
 			continue
 		}
+		metricsCollector.ObserveReconcile("applied", time.Since(start))
 		known = routerConfig
+		adminServer.SetRouterConfig(routerConfig)
+		metricsCollector.SetRouterConfig(routerConfig)
+		logForwarder.SetRouterConfig(routerConfig)
+		if err := statusReporter.Report(routerConfig); err != nil {
+			log.Printf("WARN: Unable to report status: %v.\n", err)
+		}
+	}
+}
+
+// applyRouterConfig builds router configuration from k8s and, if it differs from the known
+// configuration, applies it to nginx.  It returns the known configuration if nothing changed.
+func applyRouterConfig(kubeClient kubernetes.Interface, known *model.RouterConfig, metricsCollector *metrics.Collector) (*model.RouterConfig, error) {
+	routerConfig, err := model.Build(kubeClient)
+	if err != nil {
+		metricsCollector.ObserveBuildError()
+		log.Printf("Error building model; not modifying certs or configuration: %v.", err)
+		return nil, err
+	}
+	if reflect.DeepEqual(routerConfig, known) {
+		return known, nil
+	}
+	log.Println("INFO: Router configuration has changed in k8s.")
+	err = nginx.WriteCerts(routerConfig, *sslPath)
+	if err != nil {
+		log.Printf("Failed to write certs; continuing with existing certs, dhparam, and configuration: %v", err)
+		return nil, err
+	}
+	err = nginx.WriteDHParam(routerConfig, *sslPath)
+	if err != nil {
+		log.Printf("Failed to write dhparam; continuing with existing dhparam and configuration: %v", err)
+		return nil, err
+	}
+	err = nginx.WriteErrorPages(routerConfig, *wwwPath)
+	if err != nil {
+		log.Printf("Failed to write error pages; continuing with existing error pages and configuration: %v", err)
+		return nil, err
+	}
+	err = nginx.WriteConfig(routerConfig, *nginxConf, nginxPaths(*sslPath, *wwwPath))
+	if err != nil {
+		log.Printf("Failed to write new nginx configuration; continuing with existing configuration: %v", err)
+		return nil, err
+	}
+	err = nginx.Reload(*nginxBinary, *nginxConf)
+	metricsCollector.ObserveReload(err)
+	if err != nil {
+		log.Printf("Failed to reload nginx; continuing with existing configuration: %v", err)
+		return nil, err
+	}
+	return routerConfig, nil
+}
+
+// nginxPaths returns the paths to which nginx configuration refers, given the directories holding
+// certs and error pages.
+func nginxPaths(sslPath string, wwwPath string) nginx.Paths {
+	return nginx.Paths{
+		SSL:             sslPath,
+		WWW:             wwwPath,
+		LogPipe:         *logPipePath,
+		PIDFile:         *pidFile,
+		MaintenancePage: *maintenancePage,
+	}
+}
+
+// buildClientConfig returns the configuration for talking to the k8s API.  Inside a cluster, this
+// is the router's own service account.  Given a kubeconfig file, the router can instead run
+// outside of the cluster, e.g. on a developer's machine.
+func buildClientConfig(kubeconfig string, context string) (*rest.Config, error) {
+	if kubeconfig == "" {
+		return rest.InClusterConfig()
 	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig},
+		&clientcmd.ConfigOverrides{CurrentContext: context},
+	).ClientConfig()
 }
@@ -0,0 +1,224 @@
+// Package status reports what the router made of the objects it builds its configuration from
+// back to k8s, where their owners can see it: problems are recorded as events on the objects
+// concerned, and each routable service is annotated with a summary of its routes.
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deis/router/model"
+	"k8s.io/client-go/1.4/kubernetes"
+	"k8s.io/client-go/1.4/pkg/api/errors"
+	"k8s.io/client-go/1.4/pkg/api/unversioned"
+	"k8s.io/client-go/1.4/pkg/api/v1"
+)
+
+const (
+	// statusAnnotation is the annotation on a routable service that summarizes its routes.
+	statusAnnotation = "router.deis.io/status"
+	// eventComponent identifies the router as the source of the events it records.
+	eventComponent = "deis-router"
+)
+
+// Reporter records problems as events and keeps routable services' status annotations up to
+// date.
+type Reporter struct {
+	kubeClient kubernetes.Interface
+	// reported holds the keys of the problems for which events have been recorded, so that each
+	// problem is only recorded once for as long as it persists.
+	reported map[string]bool
+	// annotated holds the namespace and name of each service with a status annotation.
+	annotated map[string]bool
+	// events counts the events recorded, so that events recorded at the same instant are named
+	// differently.
+	events uint64
+	now    func() time.Time
+}
+
+// NewReporter returns a pointer to a new Reporter that uses the given client.
+func NewReporter(kubeClient kubernetes.Interface) *Reporter {
+	return &Reporter{
+		kubeClient: kubeClient,
+		reported:   map[string]bool{},
+		annotated:  map[string]bool{},
+		now:        time.Now,
+	}
+}
+
+// serviceStatus summarizes the routes the router built from a routable service.
+type serviceStatus struct {
+	Domains     []string `json:"domains,omitempty"`
+	TLS         []string `json:"tls,omitempty"`
+	Available   *bool    `json:"available,omitempty"`
+	Maintenance bool     `json:"maintenance,omitempty"`
+	Passthrough []string `json:"passthrough,omitempty"`
+	Streams     []string `json:"streams,omitempty"`
+	Problems    []string `json:"problems,omitempty"`
+}
+
+// Report records events for any problems in the given router configuration that haven't already
+// been reported, and updates the status annotations of the services it was built from.  It carries
+// on past failures, which are returned together as a single error; problems whose events couldn't
+// be recorded are reported again next time.
+func (r *Reporter) Report(routerConfig *model.RouterConfig) error {
+	errs := r.reportProblems(routerConfig.Problems)
+	errs = append(errs, r.reportStatuses(buildServiceStatuses(routerConfig))...)
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (r *Reporter) reportProblems(problems []*model.Problem) []string {
+	var errs []string
+	reported := map[string]bool{}
+	for _, problem := range problems {
+		key := problemKey(problem)
+		if r.reported[key] {
+			reported[key] = true
+			continue
+		}
+		if err := r.recordEvent(problem); err != nil {
+			errs = append(errs, fmt.Sprintf("unable to record event for %s %s/%s: %v", problem.Object.Kind, problem.Object.Namespace, problem.Object.Name, err))
+			continue
+		}
+		reported[key] = true
+	}
+	// Problems that have been resolved are forgotten, so they are reported again if they recur.
+	r.reported = reported
+	return errs
+}
+
+func problemKey(problem *model.Problem) string {
+	return strings.Join([]string{problem.Object.Kind, problem.Object.Namespace, problem.Object.Name, string(problem.Object.UID), problem.Reason, problem.Message}, "\x00")
+}
+
+func (r *Reporter) recordEvent(problem *model.Problem) error {
+	now := r.now()
+	timestamp := unversioned.NewTime(now)
+	r.events++
+	event := &v1.Event{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x.%x", problem.Object.Name, now.UnixNano(), r.events),
+			Namespace: problem.Object.Namespace,
+		},
+		InvolvedObject: problem.Object,
+		Reason:         problem.Reason,
+		Message:        problem.Message,
+		Source:         v1.EventSource{Component: eventComponent},
+		FirstTimestamp: timestamp,
+		LastTimestamp:  timestamp,
+		Count:          1,
+		Type:           v1.EventTypeWarning,
+	}
+	_, err := r.kubeClient.Core().Events(problem.Object.Namespace).Create(event)
+	return err
+}
+
+// buildServiceStatuses returns the status of each routable service that routes were built from or
+// that has problems, keyed by namespace and name.
+func buildServiceStatuses(routerConfig *model.RouterConfig) map[string]*serviceStatus {
+	statuses := map[string]*serviceStatus{}
+	get := func(object v1.ObjectReference) *serviceStatus {
+		key := object.Namespace + "/" + object.Name
+		if statuses[key] == nil {
+			statuses[key] = &serviceStatus{}
+		}
+		return statuses[key]
+	}
+	for _, appConfig := range routerConfig.AppConfigs {
+		if appConfig.Source.Kind != "Service" {
+			continue
+		}
+		status := get(appConfig.Source)
+		status.Domains = appConfig.Domains
+		for _, domain := range appConfig.Domains {
+			if appConfig.Certificates[domain] != nil {
+				status.TLS = append(status.TLS, domain)
+			}
+		}
+		available := appConfig.Available
+		status.Available = &available
+		status.Maintenance = appConfig.Maintenance
+	}
+	for _, passthroughConfig := range routerConfig.PassthroughConfigs {
+		get(passthroughConfig.Source).Passthrough = passthroughConfig.Domains
+	}
+	for _, streamConfig := range routerConfig.StreamConfigs {
+		status := get(streamConfig.Source)
+		status.Streams = append(status.Streams, fmt.Sprintf("%s/%d", streamConfig.Protocol, streamConfig.ListenPort))
+	}
+	for _, problem := range routerConfig.Problems {
+		if problem.Object.Kind != "Service" {
+			continue
+		}
+		status := get(problem.Object)
+		status.Problems = append(status.Problems, fmt.Sprintf("%s: %s", problem.Reason, problem.Message))
+	}
+	return statuses
+}
+
+func (r *Reporter) reportStatuses(statuses map[string]*serviceStatus) []string {
+	var errs []string
+	keys := make([]string, 0, len(statuses))
+	for key := range statuses {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	annotated := map[string]bool{}
+	for _, key := range keys {
+		data, err := json.Marshal(statuses[key])
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("unable to encode the status of service %s: %v", key, err))
+			continue
+		}
+		if err := r.annotate(key, string(data)); err != nil {
+			errs = append(errs, fmt.Sprintf("unable to update the status of service %s: %v", key, err))
+		}
+		annotated[key] = true
+	}
+	// Services that are no longer routable have their status removed.
+	for key := range r.annotated {
+		if annotated[key] {
+			continue
+		}
+		if err := r.annotate(key, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("unable to remove the status of service %s: %v", key, err))
+			annotated[key] = true
+		}
+	}
+	r.annotated = annotated
+	return errs
+}
+
+// annotate sets the status annotation of the service with the given namespace and name, or
+// removes it if status is empty.  The service is only updated if its status has changed.
+func (r *Reporter) annotate(key string, status string) error {
+	parts := strings.SplitN(key, "/", 2)
+	serviceClient := r.kubeClient.Core().Services(parts[0])
+	service, err := serviceClient.Get(parts[1])
+	if err != nil {
+		statusErr, ok := err.(*errors.StatusError)
+		if ok && statusErr.Status().Code == 404 {
+			return nil
+		}
+		return err
+	}
+	if service.Annotations[statusAnnotation] == status {
+		return nil
+	}
+	if status == "" {
+		delete(service.Annotations, statusAnnotation)
+	} else {
+		if service.Annotations == nil {
+			service.Annotations = map[string]string{}
+		}
+		service.Annotations[statusAnnotation] = status
+	}
+	_, err = serviceClient.Update(service)
+	return err
+}
@@ -0,0 +1,110 @@
+package status
+
+import (
+	"testing"
+	"time"
+
+	"github.com/deis/router/model"
+	"k8s.io/client-go/1.4/kubernetes/fake"
+	"k8s.io/client-go/1.4/pkg/api"
+	"k8s.io/client-go/1.4/pkg/api/v1"
+)
+
+func TestReport(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(
+		&v1.Service{ObjectMeta: v1.ObjectMeta{Name: "foo", Namespace: "foo", UID: "1"}},
+		&v1.Service{ObjectMeta: v1.ObjectMeta{Name: "bar", Namespace: "bar", UID: "2"}},
+	)
+	reporter := NewReporter(kubeClient)
+	now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	reporter.now = func() time.Time { return now }
+	report := func(routerConfig *model.RouterConfig) {
+		if err := reporter.Report(routerConfig); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		now = now.Add(10 * time.Second)
+	}
+	foo := v1.ObjectReference{Kind: "Service", Namespace: "foo", Name: "foo", UID: "1"}
+	bar := v1.ObjectReference{Kind: "Service", Namespace: "bar", Name: "bar", UID: "2"}
+	problem := &model.Problem{Object: bar, Reason: model.ReasonInvalidAnnotation, Message: "Ignoring value \"foo\" of annotation router.deis.io/domains."}
+	routerConfig := &model.RouterConfig{
+		AppConfigs: []*model.AppConfig{{
+			Name:         "foo",
+			Source:       foo,
+			Domains:      []string{"foo", "foo.example.com"},
+			Certificates: map[string]*model.Certificate{"foo": nil, "foo.example.com": {Cert: "cert"}},
+			Available:    true,
+		}},
+		StreamConfigs: []*model.StreamConfig{{Name: "foo", Source: foo, Protocol: "tcp", ListenPort: 1883}},
+		Problems:      []*model.Problem{problem},
+	}
+
+	report(routerConfig)
+	report(routerConfig)
+
+	events := listEvents(t, kubeClient)
+	if len(events) != 1 {
+		t.Fatalf("Expected a problem to be reported once, but got %d events", len(events))
+	}
+	event := events[0]
+	if event.InvolvedObject != bar || event.Reason != problem.Reason || event.Message != problem.Message || event.Type != v1.EventTypeWarning || event.Namespace != "bar" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+	expectStatus(t, kubeClient, "foo", `{"domains":["foo","foo.example.com"],"tls":["foo.example.com"],"available":true,"streams":["tcp/1883"]}`)
+	expectStatus(t, kubeClient, "bar", `{"problems":["InvalidAnnotation: Ignoring value \"foo\" of annotation router.deis.io/domains."]}`)
+
+	// Once bar's problem is resolved and foo is no longer routable, their statuses are removed.
+	report(&model.RouterConfig{})
+	expectStatus(t, kubeClient, "foo", "")
+	expectStatus(t, kubeClient, "bar", "")
+
+	// A problem that recurs is reported again.
+	report(routerConfig)
+	if events := listEvents(t, kubeClient); len(events) != 2 {
+		t.Errorf("Expected a recurring problem to be reported again, but got %d events", len(events))
+	}
+}
+
+func TestReportAtSameInstant(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(&v1.Service{ObjectMeta: v1.ObjectMeta{Name: "bar", Namespace: "bar", UID: "2"}})
+	reporter := NewReporter(kubeClient)
+	reporter.now = func() time.Time { return time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC) }
+	bar := v1.ObjectReference{Kind: "Service", Namespace: "bar", Name: "bar", UID: "2"}
+
+	// Problems reported within the same clock tick are still recorded as separate events.
+	for _, routerConfig := range []*model.RouterConfig{
+		{Problems: []*model.Problem{
+			{Object: bar, Reason: model.ReasonInvalidAnnotation, Message: "Ignoring value \"foo\" of annotation router.deis.io/domains."},
+			{Object: bar, Reason: model.ReasonInvalidAnnotation, Message: "Ignoring value \"bar\" of annotation router.deis.io/domainPriority."},
+		}},
+		{},
+		{Problems: []*model.Problem{
+			{Object: bar, Reason: model.ReasonInvalidAnnotation, Message: "Ignoring value \"foo\" of annotation router.deis.io/domains."},
+		}},
+	} {
+		if err := reporter.Report(routerConfig); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if events := listEvents(t, kubeClient); len(events) != 3 {
+		t.Errorf("Expected 3 events, but got %d", len(events))
+	}
+}
+
+func listEvents(t *testing.T, kubeClient *fake.Clientset) []v1.Event {
+	events, err := kubeClient.Core().Events(api.NamespaceAll).List(api.ListOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return events.Items
+}
+
+func expectStatus(t *testing.T, kubeClient *fake.Clientset, name string, expected string) {
+	service, err := kubeClient.Core().Services(name).Get(name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if actual := service.Annotations[statusAnnotation]; actual != expected {
+		t.Errorf("Expected service %s to have status %s, but got %s", name, expected, actual)
+	}
+}
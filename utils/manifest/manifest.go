@@ -0,0 +1,115 @@
+// Package manifest decodes the Kubernetes objects the router reads from the API out of manifest
+// files, so that router configuration can be produced without a cluster.
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"k8s.io/client-go/1.4/pkg/api/unversioned"
+	"k8s.io/client-go/1.4/pkg/api/v1"
+	"k8s.io/client-go/1.4/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/1.4/pkg/runtime"
+	"k8s.io/client-go/1.4/pkg/util/yaml"
+)
+
+// Decode reads a stream of YAML or JSON manifests and returns the objects they describe.  Lists
+// are flattened, and objects of kinds the router never reads (e.g. service accounts) are skipped.
+// Objects that don't specify a namespace are placed in the given one, as kubectl would.
+func Decode(r io.Reader, namespace string) ([]runtime.Object, error) {
+	objects := []runtime.Object{}
+	decoder := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		ext := runtime.RawExtension{}
+		if err := decoder.Decode(&ext); err != nil {
+			if err == io.EOF {
+				return objects, nil
+			}
+			return nil, err
+		}
+		// Empty documents, e.g. following a trailing "---", are allowed.
+		if len(ext.Raw) == 0 {
+			continue
+		}
+		decoded, err := decodeObjects(ext.Raw, namespace)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, decoded...)
+	}
+}
+
+func decodeObjects(data []byte, namespace string) ([]runtime.Object, error) {
+	typeMeta := unversioned.TypeMeta{}
+	if err := json.Unmarshal(data, &typeMeta); err != nil {
+		return nil, err
+	}
+	var meta *v1.ObjectMeta
+	var object runtime.Object
+	switch typeMeta.Kind {
+	case "List":
+		list := struct {
+			Items []runtime.RawExtension `json:"items"`
+		}{}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+		objects := []runtime.Object{}
+		for _, item := range list.Items {
+			decoded, err := decodeObjects(item.Raw, namespace)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, decoded...)
+		}
+		return objects, nil
+	case "Deployment":
+		deployment := &v1beta1.Deployment{}
+		meta, object = &deployment.ObjectMeta, deployment
+	case "Ingress":
+		ingress := &v1beta1.Ingress{}
+		meta, object = &ingress.ObjectMeta, ingress
+	case "Service":
+		service := &v1.Service{}
+		meta, object = &service.ObjectMeta, service
+	case "Endpoints":
+		endpoints := &v1.Endpoints{}
+		meta, object = &endpoints.ObjectMeta, endpoints
+	case "Secret":
+		secret := &v1.Secret{}
+		meta, object = &secret.ObjectMeta, secret
+	case "ConfigMap":
+		configMap := &v1.ConfigMap{}
+		meta, object = &configMap.ObjectMeta, configMap
+	case "Namespace":
+		ns := &v1.Namespace{}
+		if err := json.Unmarshal(data, ns); err != nil {
+			return nil, err
+		}
+		return []runtime.Object{ns}, nil
+	case "":
+		return nil, fmt.Errorf("manifest does not specify a kind")
+	default:
+		log.Printf("WARN: Ignoring manifest of kind %s.\n", typeMeta.Kind)
+		return nil, nil
+	}
+	if err := json.Unmarshal(data, object); err != nil {
+		return nil, fmt.Errorf("invalid %s manifest: %v", typeMeta.Kind, err)
+	}
+	if meta.Namespace == "" {
+		meta.Namespace = namespace
+	}
+	// The API server merges a secret's string data into its data; do the same.
+	if secret, ok := object.(*v1.Secret); ok {
+		for key, value := range secret.StringData {
+			if secret.Data == nil {
+				secret.Data = map[string][]byte{}
+			}
+			secret.Data[key] = []byte(value)
+		}
+		secret.StringData = nil
+	}
+	return []runtime.Object{object}, nil
+}
@@ -0,0 +1,59 @@
+package manifest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/1.4/pkg/api/v1"
+	"k8s.io/client-go/1.4/pkg/apis/extensions/v1beta1"
+)
+
+func TestDecode(t *testing.T) {
+	manifests := `{"apiVersion": "extensions/v1beta1", "kind": "Deployment", "metadata": {"name": "deis-router", "namespace": "deis"}}
+{"apiVersion": "v1", "kind": "ServiceAccount", "metadata": {"name": "deis-router"}}
+{"apiVersion": "v1", "kind": "List", "items": [
+	{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "foo", "annotations": {"router.deis.io/domains": "foo"}}},
+	{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "foo-cert"}, "data": {"tls.crt": "Zm9v"}, "stringData": {"tls.key": "bar"}}
+]}
+`
+	objects, err := Decode(strings.NewReader(manifests), "default")
+	if err != nil {
+		t.Fatalf("Encountered an error: %v", err)
+	}
+	if len(objects) != 3 {
+		t.Fatalf("Expected 3 objects, but got %d", len(objects))
+	}
+	deployment, ok := objects[0].(*v1beta1.Deployment)
+	if !ok || deployment.Name != "deis-router" || deployment.Namespace != "deis" {
+		t.Errorf("Expected the deis/deis-router deployment, but got %v", objects[0])
+	}
+	service, ok := objects[1].(*v1.Service)
+	if !ok || service.Name != "foo" || service.Annotations["router.deis.io/domains"] != "foo" {
+		t.Errorf("Expected the foo service, but got %v", objects[1])
+	}
+	// Objects without a namespace are placed in the given one.
+	if ok && service.Namespace != "default" {
+		t.Errorf("Expected the foo service to be in namespace default, but got %s", service.Namespace)
+	}
+	secret, ok := objects[2].(*v1.Secret)
+	if !ok {
+		t.Fatalf("Expected the foo-cert secret, but got %v", objects[2])
+	}
+	// String data is merged into data.
+	expectedData := map[string][]byte{"tls.crt": []byte("foo"), "tls.key": []byte("bar")}
+	if !reflect.DeepEqual(expectedData, secret.Data) {
+		t.Errorf("Expected secret data %v, but got %v", expectedData, secret.Data)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, manifests := range []string{
+		`{"apiVersion": "v1", "metadata": {"name": "foo"}}`,
+		`{"apiVersion": "v1", "kind": "Service", "metadata": "foo"}`,
+	} {
+		if _, err := Decode(strings.NewReader(manifests), "default"); err == nil {
+			t.Errorf("Expected an error decoding %s, but got none", manifests)
+		}
+	}
+}
@@ -79,3 +79,13 @@ func newModelValidationError(field string, constraint string, value string) Mode
 func (e ModelValidationError) Error() string {
 	return fmt.Sprintf("Field \"%s\" value \"%s\" does not satisfy constraint /%s/", e.field, e.value, e.constraint)
 }
+
+// Field returns the key of the field whose value doesn't satisfy its constraint.
+func (e ModelValidationError) Field() string {
+	return e.field
+}
+
+// Value returns the value that doesn't satisfy the field's constraint.
+func (e ModelValidationError) Value() string {
+	return e.value
+}
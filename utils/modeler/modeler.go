@@ -31,11 +31,24 @@ func NewModeler(prefix string, fieldTag string, constraintTag string, warnOnVali
 
 // MapToModel populates the provided model with values from the provided map.
 func (m *Modeler) MapToModel(data map[string]string, initialContext string, out interface{}) error {
+	_, err := m.MapToModelWithWarnings(data, initialContext, out)
+	return err
+}
+
+// MapToModelWithWarnings populates the provided model with values from the provided map, just as
+// MapToModel does.  If the modeler only warns on validation errors, it also returns the errors
+// for the values that were skipped.
+func (m *Modeler) MapToModelWithWarnings(data map[string]string, initialContext string, out interface{}) ([]ModelValidationError, error) {
 	rv := reflect.ValueOf(out)
-	return m.mapToModel(data, initialContext, rv)
+	warnings := []ModelValidationError{}
+	err := m.mapToModel(data, initialContext, rv, &warnings)
+	if err != nil {
+		return nil, err
+	}
+	return warnings, nil
 }
 
-func (m *Modeler) mapToModel(data map[string]string, context string, rv reflect.Value) error {
+func (m *Modeler) mapToModel(data map[string]string, context string, rv reflect.Value, warnings *[]ModelValidationError) error {
 	// If rv is invalid (represents a nil literal), we cannot proceed.
 	if rv.Kind() == reflect.Invalid {
 		return newNilLiteralModelError()
@@ -72,7 +85,7 @@ func (m *Modeler) mapToModel(data map[string]string, context string, rv reflect.
 			} else {
 				nestedContext = fmt.Sprintf("%s.%s", context, fieldTagValue)
 			}
-			err := m.mapToModel(data, nestedContext, elem.Field(i))
+			err := m.mapToModel(data, nestedContext, elem.Field(i), warnings)
 			if err != nil {
 				return err
 			}
@@ -97,6 +110,7 @@ func (m *Modeler) mapToModel(data map[string]string, context string, rv reflect.
 						err := newModelValidationError(key, constraintTagValue, stringVal)
 						if m.warnOnValidationError {
 							log.Printf("WARNING: %s -- skipping this field and using default value \"%v\".", err, elem.Field(i))
+							*warnings = append(*warnings, err)
 							continue
 						} else {
 							return err
@@ -127,7 +141,8 @@ func (m *Modeler) mapToModel(data map[string]string, context string, rv reflect.
 					sliceVal := strings.Split(stringVal, ",")
 					mapVal := make(map[string]string, len(sliceVal))
 					for _, kvStr := range sliceVal {
-						kvTokens := strings.Split(kvStr, ":")
+						// Only the first colon separates key from value; values may contain colons.
+						kvTokens := strings.SplitN(kvStr, ":", 2)
 						key := strings.TrimSpace(kvTokens[0])
 						value := strings.TrimSpace(kvTokens[1])
 						mapVal[key] = value
@@ -90,6 +90,23 @@ func TestValidationError(t *testing.T) {
 	checkError(t, "modeler.ModelValidationError", err)
 }
 
+func TestValidationWarning(t *testing.T) {
+	sampleModel := newSampleModel()
+	warnings, err := NewModeler(prefix, fieldTag, constraintTag, true).MapToModelWithWarnings(invalidSampleData, "", sampleModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("Expected 1 warning, but got %d", len(warnings))
+	}
+	if warnings[0].Field() != prefix+"/a_string" || warnings[0].Value() != invalidSampleData[prefix+"/a_string"] {
+		t.Errorf("Expected a warning for %s, but got %s", prefix+"/a_string", warnings[0].Field())
+	}
+	if sampleModel.SampleString != "" {
+		t.Errorf("Expected the invalid value to be skipped, but got %s", sampleModel.SampleString)
+	}
+}
+
 func TestMapping(t *testing.T) {
 	sampleModel := newSampleModel()
 	err := m.MapToModel(sampleData, "", sampleModel)
@@ -107,6 +124,19 @@ func TestMapping(t *testing.T) {
 	checkStringSliceField(t, sampleData[prefix+"/a_submodel.a_string_slice"], sampleModel.SampleSubModel.SampleStringSlice)
 }
 
+func TestMapValuesContainingColons(t *testing.T) {
+	sampleModel := newSampleModel()
+	data := map[string]string{prefix + "/a_string_map": "foo:bar:baz, csp:default-src https:"}
+	err := m.MapToModel(data, "", sampleModel)
+	if err != nil {
+		t.Error(err)
+	}
+	expected := map[string]string{"foo": "bar:baz", "csp": "default-src https:"}
+	if !reflect.DeepEqual(expected, sampleModel.SampleStringMap) {
+		t.Errorf("Expected %s, but got %s", expected, sampleModel.SampleStringMap)
+	}
+}
+
 func checkError(t *testing.T, want string, err error) {
 	if err == nil {
 		t.Errorf("Expected a %s, but did not receive any error", want)